@@ -0,0 +1,136 @@
+//go:build !bedrock
+
+package main
+
+import (
+	"fmt"
+)
+
+/* ------------------------------------------------------------------------
+   AIR QUALITY
+   ------------------------------------------------------------------------ */
+
+// maxAirQualityDays is how far ahead Open-Meteo forecasts air quality
+const maxAirQualityDays = 7
+
+type airQualityArgs struct {
+	placeArgs
+	ForecastDays int    `json:"forecast_days,omitempty" desc:"Days from today, 1-7 (default 1, today only)"`
+	StartDate    string `json:"start_date,omitempty" desc:"First day for past or future days, YYYY-MM-DD; needs end_date"`
+	EndDate      string `json:"end_date,omitempty" desc:"Last day, YYYY-MM-DD"`
+}
+
+// usAQICategories are the US EPA AQI bands, by upper bound
+var usAQICategories = []struct {
+	upTo     float64
+	category string
+}{
+	{50, "Good"},
+	{100, "Moderate"},
+	{150, "Unhealthy for sensitive groups"},
+	{200, "Unhealthy"},
+	{300, "Very unhealthy"},
+}
+
+func aqiCategory(aqi float64) string {
+	for _, c := range usAQICategories {
+		if aqi <= c.upTo {
+			return c.category
+		}
+	}
+	return "Hazardous"
+}
+
+// getAirQuality reports the current US AQI and, per day, the worst AQI with
+// its category and the average particulate levels
+func (w *WeatherTools) getAirQuality(args airQualityArgs) (string, error) {
+	if (args.StartDate == "") != (args.EndDate == "") {
+		return "", fmt.Errorf("give both start_date and end_date, or neither")
+	}
+	if args.StartDate != "" && args.ForecastDays != 0 {
+		return "", fmt.Errorf("use either forecast_days or start_date/end_date, not both")
+	}
+	days := args.ForecastDays
+	if days == 0 {
+		days = 1
+	}
+	if days < 1 || days > maxAirQualityDays {
+		return "", fmt.Errorf("forecast_days must be between 1 and %d", maxAirQualityDays)
+	}
+	if args.StartDate != "" {
+		from, to, err := parseDateRange(args.StartDate, args.EndDate)
+		if err != nil {
+			return "", err
+		}
+		if n := int(to.Sub(from).Hours()/24) + 1; n > 31 {
+			return "", fmt.Errorf("the range is %d days, ask for at most 31 at a time", n)
+		}
+	}
+
+	location, lat, lon, tz, err := w.resolvePlace(args.placeArgs)
+	if err != nil {
+		return "", err
+	}
+
+	req := WeatherRequest{
+		Latitude:  lat,
+		Longitude: lon,
+		Timezone:  tz,
+		StartDate: args.StartDate,
+		EndDate:   args.EndDate,
+	}
+	if args.StartDate == "" {
+		req.Days = days
+	}
+	data, err := w.provider.AirQuality(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching air quality: %v", err)
+	}
+
+	result := fmt.Sprintf("Air quality for %s (US AQI: 0-50 good, 51-100 moderate, 101-150 unhealthy for sensitive groups, "+
+		"151-200 unhealthy, 201-300 very unhealthy, 301+ hazardous):\n", location)
+	if c := data.Current; c != nil && c.USAQI != nil {
+		result += fmt.Sprintf("Now (%s): AQI %.0f, %s", c.Time, *c.USAQI, aqiCategory(*c.USAQI))
+		if c.PM2_5 != nil {
+			result += fmt.Sprintf(", PM2.5 %.1f µg/m³", *c.PM2_5)
+		}
+		result += "\n"
+	}
+
+	// group the hourly values by day; times look like 2025-06-01T13:00
+	hourly := data.Hourly
+	var order []string
+	byDay := map[string][]int{}
+	for i, t := range hourly.Time {
+		day := t[:min(len(t), 10)]
+		if _, seen := byDay[day]; !seen {
+			order = append(order, day)
+		}
+		byDay[day] = append(byDay[day], i)
+	}
+	pick := func(values []*float64, hours []int) []*float64 {
+		picked := make([]*float64, 0, len(hours))
+		for _, i := range hours {
+			if i < len(values) {
+				picked = append(picked, values[i])
+			}
+		}
+		return picked
+	}
+
+	for _, day := range order {
+		hours := byDay[day]
+		aqi := summarize(pick(hourly.USAQI, hours))
+		if aqi.count == 0 {
+			result += fmt.Sprintf("%s: no data\n", day)
+			continue
+		}
+		pm25 := summarize(pick(hourly.PM2_5, hours))
+		pm10 := summarize(pick(hourly.PM10, hours))
+		ozone := summarize(pick(hourly.Ozone, hours))
+		result += fmt.Sprintf("%s: worst AQI %.0f (%s), average AQI %.0f; average PM2.5 %s, PM10 %s; peak ozone %s\n",
+			day, aqi.max, aqiCategory(aqi.max), aqi.mean(),
+			pm25.meanText("%.1f µg/m³"), pm10.meanText("%.1f µg/m³"), ozone.maxText("%.0f µg/m³"))
+	}
+	return result, nil
+}
@@ -1,3 +1,5 @@
+//go:build bedrock
+
 package main
 
 import (
@@ -9,50 +11,108 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
 )
 
-// AWS Credentials (Replace with secure storage in production)
+// Defaults; credentials come from the environment or secrets file (see credentials.go)
 const (
-	AWS_ACCESS_KEY    = "..."
-	AWS_SECRET_KEY    = "....."
-	AWS_SESSION_TOKEN = ".........."
-	AWS_REGION        = "us-east-1"
-	AWS_MODEL_ID      = "us.meta.llama3-2-90b-instruct-v1:0" // Use the correct Llama3 model ID
-
-	// clickhouseURL      = "https://webhook.site/317cca19-4aa5-4d9c-9c01-2dc348b6b29b/"
-	clickhouseURL      = "..."
-	clickhouseUser     = "..." // Set your ClickHouse username
-	clickhousePassword = "..." // Set your ClickHouse password
-	requestTimeout     = 10
+	AWS_REGION     = "us-east-1"
+	AWS_MODEL_ID   = "us.meta.llama3-2-90b-instruct-v1:0" // Use the correct Llama3 model ID
+	requestTimeout = 10                                   // seconds, for ClickHouse requests
+
+	// ClickHouse result limits: the server stops producing rows past
+	// max_result_rows/max_result_bytes, and we cut what reaches the model further
+	defaultServerMaxRows  = 10000
+	defaultServerMaxBytes = 10 << 20
+	defaultMaxRows        = 100
+	defaultMaxBytes       = 16000
+
+	stream = true // render replies with ConverseStream as they're generated
 )
 
+// systemPrompt is filled in with the registry's tool list
 const systemPrompt = `You are a friendly AI Assistant.  
 You can converse normally, as well as call tools when necessary.
-You have access to the following tool:
-1. "get_time" - Returns the current system time in HH:MM:SS format.
-2. "clickhouse_tool" - Executes an SQL query on ClickHouse and returns the response as a JSON string.
-2. "no_tool" - don't call a tool (this is a stub).
-
+You have access to the following tools:
+%s
+Never put literal values from the conversation into SQL text; use {name:Type} placeholders in the query and pass the values in params.
+Before writing SQL for clickhouse_tool, look up the real database, table and column names with the clickhouse_list_* and clickhouse_describe_table tools instead of guessing.
 You do not need to call any tool unless the user SPECIFICALLY requests data that would require the tool, like asking the current time.
 In fact, don't mention the tools at all, assume the user knows whatever they need to know to use the tool.`
 
-// Function to get the current time
-func getTime() string {
-	return time.Now().Format("15:04:05")
+// ClickhouseClient holds the connection settings for the ClickHouse HTTP interface
+type ClickhouseClient struct {
+	URL      string
+	User     string
+	Password string
+	HTTP     *http.Client
+
+	// AllowedStatements are the statement kinds the model may run (see clickhouse_guard.go)
+	AllowedStatements []string
+
+	// ServerMaxRows and ServerMaxBytes are sent as max_result_rows and
+	// max_result_bytes with result_overflow_mode=break, so a broad SELECT is
+	// cut off by the server instead of streaming everything back (0 = no limit)
+	ServerMaxRows  int
+	ServerMaxBytes int
+
+	// MaxRows and MaxBytes cap the rows and JSON bytes handed to the model
+	MaxRows  int
+	MaxBytes int
+}
+
+// NewClickhouseClient returns a read-only client with the default request timeout and result limits
+func NewClickhouseClient(url, user, password string) *ClickhouseClient {
+	return &ClickhouseClient{
+		URL:               url,
+		User:              user,
+		Password:          password,
+		HTTP:              &http.Client{Timeout: requestTimeout * time.Second},
+		AllowedStatements: defaultAllowedStatements,
+		ServerMaxRows:     defaultServerMaxRows,
+		ServerMaxBytes:    defaultServerMaxBytes,
+		MaxRows:           defaultMaxRows,
+		MaxBytes:          defaultMaxBytes,
+	}
+}
+
+// requestURL adds ClickHouse settings and query parameter values (as param_<name>)
+// to the server URL. readonly=1 is always set, so the server refuses writes
+// even if a query gets past guardQuery.
+func (c *ClickhouseClient) requestURL(params map[string]string) (string, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid ClickHouse URL: %v", err)
+	}
+	q := u.Query()
+	for name, value := range params {
+		q.Set("param_"+name, value)
+	}
+	q.Set("readonly", "1")
+	if c.ServerMaxRows > 0 {
+		q.Set("max_result_rows", strconv.Itoa(c.ServerMaxRows))
+	}
+	if c.ServerMaxBytes > 0 {
+		q.Set("max_result_bytes", strconv.Itoa(c.ServerMaxBytes))
+	}
+	if c.ServerMaxRows > 0 || c.ServerMaxBytes > 0 {
+		q.Set("result_overflow_mode", "break")
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
 }
 
 // ClickhouseTool executes an SQL query on ClickHouse and returns the response as a JSON string.
-func clickhouseTool(args ...interface{}) (string, error) {
+func (c *ClickhouseClient) clickhouseTool(args ...interface{}) (string, error) {
 	// Validate input
 	if len(args) == 0 {
 		return "", errors.New("missing SQL query argument")
@@ -62,122 +122,468 @@ func clickhouseTool(args ...interface{}) (string, error) {
 	if !ok {
 		return "", errors.New("first argument must be a string containing the SQL query")
 	}
+	// optional second argument: values for the query's {name:Type} placeholders
+	var values map[string]interface{}
+	if len(args) > 1 {
+		values, _ = args[1].(map[string]interface{})
+	}
+
+	// Only a single read-only statement gets through; the trailing ; is dropped
+	query, err := guardQuery(query, c.AllowedStatements)
+	if err != nil {
+		return "", err
+	}
+	params, err := queryParams(query, values)
+	if err != nil {
+		return "", err
+	}
+	query += " FORMAT JSON;"
 
-	// Ensure query is properly formatted
-	query = strings.TrimSpace(query)
-	if strings.HasSuffix(query, ";") {
-		query = query[:len(query)-1]
+	body, err := c.run(query, params)
+	if err != nil {
+		return "", err
 	}
-	query += " FORMAT JSONObjectEachRow;"
 
+	// Parse response into JSON
+	var result clickhouseResult
+	//debugging
+	fmt.Println("clickhouseTool: body: ", string(body))
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("error parsing JSON: %v", err)
+	}
+
+	// Convert structured response to JSON string, cut down to what fits
+	rows, notice := c.truncateRows(result)
+	response := map[string]interface{}{
+		"query":  query,
+		"result": rows,
+	}
+	if notice != "" {
+		response["notice"] = notice
+	}
+	responseJSON, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error encoding JSON: %v", err)
+	}
+
+	return string(responseJSON), nil
+}
+
+// clickhouseResult is the part of ClickHouse's FORMAT JSON output we use.
+// Rows stay raw so their column order is kept and their size is known.
+type clickhouseResult struct {
+	Data []json.RawMessage `json:"data"`
+	// RowsBeforeLimit is the row count before any LIMIT, a lower bound
+	RowsBeforeLimit *int `json:"rows_before_limit_at_least"`
+}
+
+// truncateRows keeps as many rows as fit in MaxRows and MaxBytes, and returns
+// a notice for the model saying how many rows there were and how many it got
+func (c *ClickhouseClient) truncateRows(result clickhouseResult) ([]json.RawMessage, string) {
+	rows := result.Data
+	if c.MaxRows > 0 && len(rows) > c.MaxRows {
+		rows = rows[:c.MaxRows]
+	}
+	if c.MaxBytes > 0 {
+		size := 0
+		for i, row := range rows {
+			size += len(row) + 1
+			if size > c.MaxBytes {
+				rows = rows[:i]
+				break
+			}
+		}
+	}
+
+	// with result_overflow_mode=break the server quietly stops at its limit,
+	// so all we know then is that there were at least that many rows
+	count := len(result.Data)
+	if result.RowsBeforeLimit != nil && *result.RowsBeforeLimit > count {
+		count = *result.RowsBeforeLimit
+	}
+	serverCut := c.ServerMaxRows > 0 && len(result.Data) >= c.ServerMaxRows
+	if len(rows) == len(result.Data) && !serverCut {
+		return rows, ""
+	}
+	total := fmt.Sprint(count)
+	if serverCut || count > len(result.Data) {
+		total = "at least " + total
+	}
+	return rows, fmt.Sprintf("Result truncated: returned %d of %s rows. "+
+		"Use a LIMIT, aggregate, filter, or select fewer columns to see the rest.", len(rows), total)
+}
+
+// run POSTs a query to ClickHouse with its parameter values and returns the raw response body
+func (c *ClickhouseClient) run(query string, params map[string]string) ([]byte, error) {
 	// Prepare request
-	req, err := http.NewRequest("POST", clickhouseURL, bytes.NewBuffer([]byte(query)))
+	requestURL, err := c.requestURL(params)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", requestURL, bytes.NewBuffer([]byte(query)))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	// Set headers
-	req.Header.Set("X-ClickHouse-User", clickhouseUser)
-	req.Header.Set("X-ClickHouse-Key", clickhousePassword)
+	req.Header.Set("X-ClickHouse-User", c.User)
+	req.Header.Set("X-ClickHouse-Key", c.Password)
 	req.Header.Set("Content-Type", "text/plain")
 
 	// Execute request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.HTTP.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("API request failed: %v", err)
+		return nil, fmt.Errorf("API request failed: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// Read response
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %v", err)
+		return nil, fmt.Errorf("failed to read response body: %v", err)
 	}
 
-	// Parse response into JSON
-	var result interface{}
-	//debugging
-	fmt.Println("clickhouseTool: body: ", string(body))
+	// Server-side rejections (readonly mode, syntax errors, ...) come back as
+	// plain text; pass them on so the model can fix the query
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ClickHouse returned HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// rows runs one of our own queries (not the model's) and decodes the rows
+func (c *ClickhouseClient) rows(query string, params map[string]string) ([]map[string]interface{}, error) {
+	body, err := c.run(query+" FORMAT JSON", params)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Data []map[string]interface{} `json:"data"`
+	}
 	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("error parsing JSON: %v", err)
+		return nil, fmt.Errorf("error parsing JSON: %v", err)
 	}
+	return result.Data, nil
+}
 
-	// Convert structured response to JSON string
-	responseJSON, err := json.MarshalIndent(map[string]interface{}{
-		"query":  query,
-		"result": result,
-	}, "", "  ")
+/* ------------------------------------------------------------------------
+   BEDROCK PROVIDER
+   ------------------------------------------------------------------------ */
+
+// BedrockProvider is the Provider for the Bedrock Converse API
+type BedrockProvider struct {
+	Client  *bedrockruntime.Client
+	ModelID string
+	Stream  bool // use ConverseStream and print text as it arrives
+}
+
+// NewBedrockProvider wraps an existing Bedrock runtime client
+func NewBedrockProvider(client *bedrockruntime.Client, modelID string) *BedrockProvider {
+	return &BedrockProvider{Client: client, ModelID: modelID}
+}
+
+// Chat converts the neutral conversation to Converse messages and sends it
+func (p *BedrockProvider) Chat(messages []ChatMessage, specs []ToolSpec) (*ChatResponse, error) {
+	system, converseMessages := bedrockMessages(messages)
+	toolConfig := bedrockToolConfig(specs)
+
+	if p.Stream {
+		return p.converseStream(system, converseMessages, toolConfig)
+	}
+
+	resp, err := p.Client.Converse(context.TODO(), &bedrockruntime.ConverseInput{
+		ModelId:    aws.String(p.ModelID),
+		Messages:   converseMessages,
+		System:     system,
+		ToolConfig: toolConfig,
+	})
 	if err != nil {
-		return "", fmt.Errorf("error encoding JSON: %v", err)
+		return nil, err
 	}
 
-	return string(responseJSON), nil
+	output, ok := resp.Output.(*types.ConverseOutputMemberMessage)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response type %T", resp.Output)
+	}
+
+	result := &ChatResponse{}
+	for _, block := range output.Value.Content {
+		switch b := block.(type) {
+		case *types.ContentBlockMemberText:
+			result.Content += b.Value
+		case *types.ContentBlockMemberToolUse:
+			args, err := decodeToolInput(b.Value.Input)
+			if err != nil {
+				return nil, err
+			}
+			result.ToolCalls = append(result.ToolCalls, ChatToolCall{
+				ID:        aws.ToString(b.Value.ToolUseId),
+				Name:      aws.ToString(b.Value.Name),
+				Arguments: args,
+			})
+		}
+	}
+	return result, nil
 }
 
-func main() {
-	// Load AWS Config with Hardcoded Credentials
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(AWS_ACCESS_KEY, AWS_SECRET_KEY, AWS_SESSION_TOKEN)),
-		config.WithRegion(AWS_REGION),
-	)
+// converseStream sends the request with ConverseStream, printing text deltas
+// as they arrive. Tool calls come in pieces: a contentBlockStart with the name
+// and id, then contentBlockDeltas carrying chunks of the JSON input, which we
+// stitch back together per content block index.
+func (p *BedrockProvider) converseStream(system []types.SystemContentBlock, messages []types.Message,
+	toolConfig *types.ToolConfiguration) (*ChatResponse, error) {
+	out, err := p.Client.ConverseStream(context.TODO(), &bedrockruntime.ConverseStreamInput{
+		ModelId:    aws.String(p.ModelID),
+		Messages:   messages,
+		System:     system,
+		ToolConfig: toolConfig,
+	})
 	if err != nil {
-		fmt.Println("Error loading AWS config:", err)
-		return
+		return nil, err
 	}
+	stream := out.GetStream()
+	defer stream.Close()
 
-	// Initialize AWS Bedrock client
-	client := bedrockruntime.NewFromConfig(cfg)
+	type toolBlock struct {
+		call  ChatToolCall
+		input strings.Builder
+	}
+	toolBlocks := map[int32]*toolBlock{}
+	var toolOrder []int32
+
+	result := &ChatResponse{Streamed: true}
+	printing := false
+
+	for event := range stream.Events() {
+		switch e := event.(type) {
+		case *types.ConverseStreamOutputMemberContentBlockStart:
+			if start, ok := e.Value.Start.(*types.ContentBlockStartMemberToolUse); ok {
+				index := aws.ToInt32(e.Value.ContentBlockIndex)
+				toolBlocks[index] = &toolBlock{call: ChatToolCall{
+					ID:   aws.ToString(start.Value.ToolUseId),
+					Name: aws.ToString(start.Value.Name),
+				}}
+				toolOrder = append(toolOrder, index)
+			}
 
-	// Conversation history
-	var conversationHistory []types.Message
-
-	// Tool configuration for get_time
-	toolConfig := &types.ToolConfiguration{
-		Tools: []types.Tool{
-			&types.ToolMemberToolSpec{
-				Value: types.ToolSpecification{
-					Name:        aws.String("get_time"),
-					Description: aws.String("Returns the current system time in HH:MM:SS format."),
-					InputSchema: &types.ToolInputSchemaMemberJson{
-						Value: document.NewLazyDocument(map[string]interface{}{
-							"type":       "object",
-							"properties": map[string]interface{}{}, // No input parameters
-						}),
-					},
-				},
-			},
-			&types.ToolMemberToolSpec{
-				Value: types.ToolSpecification{
-					Name:        aws.String("clickhouse_tool"),
-					Description: aws.String("Executes an SQL query on ClickHouse and returns the response as a JSON string."),
-					InputSchema: &types.ToolInputSchemaMemberJson{
-						Value: document.NewLazyDocument(map[string]interface{}{
-							"type": "object",
-							"properties": map[string]interface{}{
-								// 		"query": map[string]interface{}{
-								"type": "string",
-								// 	},
-							},
-							"required": []string{"query"},
-						}),
-					},
+		case *types.ConverseStreamOutputMemberContentBlockDelta:
+			switch delta := e.Value.Delta.(type) {
+			case *types.ContentBlockDeltaMemberText:
+				if !printing {
+					fmt.Print("Assistant: ")
+					printing = true
+				}
+				fmt.Print(delta.Value)
+				result.Content += delta.Value
+			case *types.ContentBlockDeltaMemberToolUse:
+				if block, ok := toolBlocks[aws.ToInt32(e.Value.ContentBlockIndex)]; ok {
+					block.input.WriteString(aws.ToString(delta.Value.Input))
+				}
+			}
+		}
+	}
+	if printing {
+		fmt.Println()
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, index := range toolOrder {
+		block := toolBlocks[index]
+		if input := block.input.String(); input != "" {
+			args, err := decodeJSONArgs([]byte(input))
+			if err != nil {
+				return nil, fmt.Errorf("%v\nRaw: %s", err, input)
+			}
+			block.call.Arguments = args
+		}
+		result.ToolCalls = append(result.ToolCalls, block.call)
+	}
+	return result, nil
+}
+
+// bedrockMessages splits the neutral conversation into Converse system blocks and messages.
+// Assistant tool calls become toolUse blocks and tool results become toolResult
+// blocks carrying the matching toolUseId, so the model knows which is which.
+func bedrockMessages(messages []ChatMessage) ([]types.SystemContentBlock, []types.Message) {
+	var system []types.SystemContentBlock
+	var converseMessages []types.Message
+
+	for _, m := range messages {
+		// System prompts go in their own field, not in the message list
+		if m.Role == "system" {
+			system = append(system, &types.SystemContentBlockMemberText{Value: m.Content})
+			continue
+		}
+
+		var role types.ConversationRole
+		var blocks []types.ContentBlock
+		switch m.Role {
+		case "assistant":
+			role = types.ConversationRoleAssistant
+			// Converse rejects empty text blocks, which tool-call turns often have
+			if m.Content != "" {
+				blocks = append(blocks, &types.ContentBlockMemberText{Value: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				args := tc.Arguments
+				if args == nil {
+					args = map[string]interface{}{}
+				}
+				blocks = append(blocks, &types.ContentBlockMemberToolUse{Value: types.ToolUseBlock{
+					ToolUseId: aws.String(tc.ID),
+					Name:      aws.String(tc.Name),
+					Input:     document.NewLazyDocument(args),
+				}})
+			}
+
+		case "tool":
+			// Tool results go back in a user turn, tied to the toolUse by id
+			role = types.ConversationRoleUser
+			result := types.ToolResultBlock{
+				ToolUseId: aws.String(m.ToolCallID),
+				Content: []types.ToolResultContentBlock{
+					&types.ToolResultContentBlockMemberText{Value: m.Content},
 				},
-			},
-			&types.ToolMemberToolSpec{
-				Value: types.ToolSpecification{
-					Name:        aws.String("no_tool"),
-					Description: aws.String("Stub tool that does nothing."),
-					InputSchema: &types.ToolInputSchemaMemberJson{
-						Value: document.NewLazyDocument(map[string]interface{}{
-							"type":       "object",
-							"properties": map[string]interface{}{}, // No input parameters
-						}),
-					},
+			}
+			if m.IsError {
+				result.Status = types.ToolResultStatusError
+			}
+			blocks = append(blocks, &types.ContentBlockMemberToolResult{Value: result})
+
+		default:
+			role = types.ConversationRoleUser
+			blocks = append(blocks, &types.ContentBlockMemberText{Value: m.Content})
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		// Converse wants roles to alternate, so merge consecutive turns of the same role
+		if n := len(converseMessages); n > 0 && converseMessages[n-1].Role == role {
+			converseMessages[n-1].Content = append(converseMessages[n-1].Content, blocks...)
+			continue
+		}
+		converseMessages = append(converseMessages, types.Message{
+			Role:    role,
+			Content: blocks,
+		})
+	}
+	return system, converseMessages
+}
+
+// decodeToolInput turns a toolUse input document into plain JSON values.
+// Numbers come back as json.Number rather than smithy document.Number, so
+// validation handles them, and an id like 12345678901234567890 keeps its
+// digits instead of being rounded through float64.
+func decodeToolInput(input document.Interface) (map[string]interface{}, error) {
+	if input == nil {
+		return nil, nil
+	}
+	raw, err := input.MarshalSmithyDocument()
+	if err != nil {
+		return nil, fmt.Errorf("error reading tool input: %v", err)
+	}
+	return decodeJSONArgs(raw)
+}
+
+// decodeJSONArgs decodes tool-call arguments, keeping numbers as json.Number
+func decodeJSONArgs(raw []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var args map[string]interface{}
+	if err := dec.Decode(&args); err != nil {
+		return nil, fmt.Errorf("error unmarshalling tool input: %v", err)
+	}
+	return args, nil
+}
+
+// bedrockToolConfig builds the Converse tool configuration from the registry's specs
+func bedrockToolConfig(specs []ToolSpec) *types.ToolConfiguration {
+	if len(specs) == 0 {
+		return nil
+	}
+	toolConfig := &types.ToolConfiguration{ToolChoice: &types.ToolChoiceMemberAuto{}}
+	for _, spec := range specs {
+		toolConfig.Tools = append(toolConfig.Tools, &types.ToolMemberToolSpec{
+			Value: types.ToolSpecification{
+				Name:        aws.String(spec.Name),
+				Description: aws.String(spec.Description),
+				InputSchema: &types.ToolInputSchemaMemberJson{
+					Value: document.NewLazyDocument(spec.Parameters),
 				},
 			},
-		},
-		ToolChoice: &types.ToolChoiceMemberAuto{},
+		})
+	}
+	return toolConfig
+}
+
+/* ------------------------------------------------------------------------
+   TOOLS
+   ------------------------------------------------------------------------ */
+
+type clickhouseArgs struct {
+	Query  string                 `json:"query" desc:"The SQL query to run. Write values as {name:Type} placeholders, e.g. WHERE city = {city:String}" minlen:"1"`
+	Params map[string]interface{} `json:"params,omitempty" desc:"Values for the query's placeholders by name, e.g. {\"city\": \"Paris\"}"`
+}
+
+// newToolRegistry registers every tool this client offers the model
+func newToolRegistry(clickhouse *ClickhouseClient, geocoder Geocoder) *Registry {
+	r := NewRegistry()
+
+	registerTimeTools(r, geocoder)
+
+	RegisterTyped(r, "clickhouse_tool", "Executes a single read-only SQL query (SELECT, SHOW, DESCRIBE or EXPLAIN) on ClickHouse and returns the response as a JSON string.",
+		func(args clickhouseArgs) (string, error) {
+			return clickhouse.clickhouseTool(args.Query, args.Params)
+		})
+
+	// Schema lookups so the model can write SQL against real table names
+	NewClickhouseSchema(clickhouse).register(r)
+
+	RegisterTyped(r, "no_tool", "Stub tool that does nothing.",
+		func(args noArgs) (string, error) {
+			toolResponseData, err := json.Marshal(map[string]string{"no_tool": "no response"})
+			if err != nil {
+				return "", fmt.Errorf("encoding tool response: %v", err)
+			}
+			return string(toolResponseData), nil
+		})
+
+	return r
+}
+
+/* ------------------------------------------------------------------------
+   MAIN
+   ------------------------------------------------------------------------ */
+
+func main() {
+	// Resolve credentials from the environment, AWS profiles and the secrets file
+	settings, err := loadSettings()
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	cfg, err := loadAWSConfig(settings)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	// Initialize AWS Bedrock client
+	provider := NewBedrockProvider(bedrockruntime.NewFromConfig(cfg), settings.ModelID)
+	provider.Stream = stream
+
+	// Tools the model can call
+	clickhouse := NewClickhouseClient(settings.ClickhouseURL, settings.ClickhouseUser, settings.ClickhousePassword)
+	clickhouse.ServerMaxRows, clickhouse.ServerMaxBytes = settings.ClickhouseServerMaxRows, settings.ClickhouseServerMaxBytes
+	clickhouse.MaxRows, clickhouse.MaxBytes = settings.ClickhouseMaxRows, settings.ClickhouseMaxBytes
+	registry := newToolRegistry(clickhouse, openMeteoFromEnv())
+
+	// Conversation history
+	conversationHistory := []ChatMessage{
+		{Role: "system", Content: fmt.Sprintf(systemPrompt, registry.Describe())},
 	}
 
 	// User input scanner
@@ -196,171 +602,15 @@ func main() {
 		}
 
 		// Append user input to conversation history
-		conversationHistory = append(conversationHistory, types.Message{
-			Role:    types.ConversationRoleUser,
-			Content: []types.ContentBlock{&types.ContentBlockMemberText{Value: userInput}},
+		conversationHistory = append(conversationHistory, ChatMessage{
+			Role:    "user",
+			Content: userInput,
 		})
 
-		// Call Converse API
-		resp, err := client.Converse(context.TODO(), &bedrockruntime.ConverseInput{
-			ModelId:    aws.String(AWS_MODEL_ID),
-			Messages:   conversationHistory,
-			ToolConfig: toolConfig,
-			System: []types.SystemContentBlock{
-				&types.SystemContentBlockMemberText{Value: systemPrompt},
-			},
-		})
-		if err != nil {
-			fmt.Println("Error:", err)
-			continue
-		}
-
-		// Check if the model requested tool invocation
-		if resp.StopReason == types.StopReasonToolUse {
-			// Extract tool use request
-			toolUse, ok := resp.Output.(*types.ConverseOutputMemberMessage)
-			if !ok || len(toolUse.Value.Content) == 0 {
-				fmt.Println("AI: (Unexpected tool request format)")
-				continue
-			}
-
-			// Assume the model requested "get_time"
-			toolName := *toolUse.Value.Content[0].(*types.ContentBlockMemberToolUse).Value.Name
-			// fmt.Printf("Tool request: %v\n", *toolUse.Value.Content[0].(*types.ContentBlockMemberToolUse).Value.Name)
-			fmt.Printf("Tool request: %v\n", toolName)
-			// if *toolUse.Value.Content[0].(*types.ContentBlockMemberToolUse).Value.Name == "get_time" {
-			if toolName == "get_time" {
-				// Execute the function
-				currentTime := getTime()
-
-				// Format tool response as JSON
-				toolResponseData, err := json.Marshal(map[string]string{"time": currentTime})
-				if err != nil {
-					fmt.Println("Error encoding tool response:", err)
-					continue
-				}
-
-				// Create tool response message
-				toolResponse := types.Message{
-					Role: types.ConversationRoleUser,
-					Content: []types.ContentBlock{
-						&types.ContentBlockMemberText{Value: string(toolResponseData)},
-					},
-				}
-
-				// Append tool response to conversation history
-				conversationHistory = append(conversationHistory, toolResponse)
-
-				// Send tool response back to Bedrock for final response generation
-				resp, err = client.Converse(context.TODO(), &bedrockruntime.ConverseInput{
-					ModelId:  aws.String(AWS_MODEL_ID),
-					Messages: conversationHistory,
-				})
-				if err != nil {
-					fmt.Println("Error:", err)
-					continue
-				}
-				//
-			} else if toolName == "clickhouse_tool" {
-				toolRequest := toolUse.Value.Content[0]
-				inputDoc := toolRequest.(*types.ContentBlockMemberToolUse).Value.Input
-
-				fmt.Printf("Tool request: %v\n", inputDoc)
-				var queryMap map[string]interface{}
-				err := inputDoc.UnmarshalSmithyDocument(&queryMap)
-				if err != nil {
-					fmt.Println("Error unmarshalling input:", err)
-					continue
-				}
-
-				result, err := clickhouseTool(queryMap["query"])
-				if err != nil {
-					fmt.Println("Error calling ClickHouse tool:", err)
-					continue
-				}
-
-				// fmt.Println("ClickHouse Result:", result)
-
-				// Append AI tool request to history (AI asking for a tool)
-				conversationHistory = append(conversationHistory, types.Message{
-					Role:    types.ConversationRoleAssistant,
-					Content: []types.ContentBlock{&types.ContentBlockMemberText{Value: "Calling ClickHouse tool..."}},
-				})
-
-				// Append AI tool request to history (AI asking for a tool)
-				conversationHistory = append(conversationHistory, types.Message{
-					Role:    types.ConversationRoleAssistant,
-					Content: []types.ContentBlock{&types.ContentBlockMemberText{Value: "Calling ClickHouse tool..."}},
-				})
-
-				// Append tool response to conversation history as a user message (fix)
-				conversationHistory = append(conversationHistory, types.Message{
-					Role: types.ConversationRoleUser, // <- Change role to USER
-					Content: []types.ContentBlock{
-						&types.ContentBlockMemberText{Value: result},
-					},
-				})
-
-				// Send tool response back to Bedrock to generate the final response
-				resp, err = client.Converse(context.TODO(), &bedrockruntime.ConverseInput{
-					ModelId:  aws.String(AWS_MODEL_ID),
-					Messages: conversationHistory,
-				})
-				if err != nil {
-					fmt.Println("Error:", err)
-					continue
-				}
-
-			} else if toolName == "no_tool" {
-				// copy of the get_time but with a "no value" instead of the getTime() function call
-				// Format tool response as JSON
-				toolResponseData, err := json.Marshal(map[string]string{"no_tool": "no response"})
-				if err != nil {
-					fmt.Println("Error encoding tool response:", err)
-					continue
-				}
-
-				// Create tool response message
-				toolResponse := types.Message{
-					Role: types.ConversationRoleUser,
-					Content: []types.ContentBlock{
-						&types.ContentBlockMemberText{Value: string(toolResponseData)},
-					},
-				}
-
-				// Append tool response to conversation history
-				conversationHistory = append(conversationHistory, toolResponse)
-
-				// Send tool response back to Bedrock for final response generation
-				resp, err = client.Converse(context.TODO(), &bedrockruntime.ConverseInput{
-					ModelId:  aws.String(AWS_MODEL_ID),
-					Messages: conversationHistory,
-				})
-				if err != nil {
-					fmt.Println("Error:", err)
-					continue
-				}
-			}
-		}
-
-		// Extract AI's final response
-		if output, ok := resp.Output.(*types.ConverseOutputMemberMessage); ok {
-			assistantMessage := output.Value
-			if len(assistantMessage.Content) > 0 {
-				if textBlock, ok := assistantMessage.Content[0].(*types.ContentBlockMemberText); ok {
-					fmt.Println("AI:", textBlock.Value)
-
-					// Append AI response to conversation history
-					conversationHistory = append(conversationHistory, assistantMessage)
-				} else {
-					fmt.Println("AI: (No text response received)")
-				}
-			} else {
-				fmt.Println("AI: (Empty response)")
-			}
-		} else {
-			fmt.Println("AI: (Unexpected response type)")
-		}
+		// Same loop as the Ollama client: keep calling Converse (with the tool
+		// config and system prompt every time) and running every toolUse block
+		// in each reply, until the model answers in plain text or hits the cap
+		conversationHistory = runAgentTurn(provider, conversationHistory, registry)
 	}
 
 	fmt.Println("Goodbye!")
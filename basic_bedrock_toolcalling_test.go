@@ -0,0 +1,54 @@
+//go:build bedrock
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTruncateRows(t *testing.T) {
+	rowsOf := func(n int) []json.RawMessage {
+		rows := make([]json.RawMessage, n)
+		for i := range rows {
+			rows[i] = json.RawMessage(fmt.Sprintf(`{"id":%d}`, i))
+		}
+		return rows
+	}
+	intPtr := func(n int) *int { return &n }
+
+	tests := []struct {
+		name            string
+		rows            int
+		rowsBeforeLimit *int
+		maxRows         int
+		maxBytes        int
+		serverMaxRows   int
+		wantRows        int
+		wantNotice      string // "" for none
+	}{
+		{"fits", 5, nil, 10, 0, 1000, 5, ""},
+		{"cut by row cap", 150, nil, 100, 0, 10000, 100, "returned 100 of 150 rows"},
+		{"cut by byte cap", 50, nil, 100, 40, 10000, 4, "returned 4 of 50 rows"},
+		{"server stopped at its row limit", 1000, nil, 100, 0, 1000, 100, "returned 100 of at least 1000 rows"},
+		{"server limit reached but all rows fit", 10, nil, 100, 0, 10, 10, "returned 10 of at least 10 rows"},
+		{"rows before a LIMIT", 150, intPtr(5000), 100, 0, 10000, 100, "returned 100 of at least 5000 rows"},
+		{"LIMIT without truncation", 10, intPtr(5000), 100, 0, 10000, 10, ""},
+		{"no limits", 500, nil, 0, 0, 0, 500, ""},
+	}
+	for _, tt := range tests {
+		c := &ClickhouseClient{MaxRows: tt.maxRows, MaxBytes: tt.maxBytes, ServerMaxRows: tt.serverMaxRows, ServerMaxBytes: defaultServerMaxBytes}
+		rows, notice := c.truncateRows(clickhouseResult{Data: rowsOf(tt.rows), RowsBeforeLimit: tt.rowsBeforeLimit})
+		if len(rows) != tt.wantRows {
+			t.Errorf("%s: got %d rows, want %d", tt.name, len(rows), tt.wantRows)
+		}
+		if tt.wantNotice == "" && notice != "" {
+			t.Errorf("%s: got notice %q, want none", tt.name, notice)
+		}
+		if tt.wantNotice != "" && !strings.Contains(notice, tt.wantNotice) {
+			t.Errorf("%s: got notice %q, want it to contain %q", tt.name, notice, tt.wantNotice)
+		}
+	}
+}
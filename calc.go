@@ -0,0 +1,646 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/* ------------------------------------------------------------------------
+   MATH EVALUATION
+   ------------------------------------------------------------------------ */
+
+// Calculation modes for the calc tool's mode argument
+const (
+	modeFloat = "float" // float64, the default
+	modeExact = "exact" // exact rationals, results as fractions
+	modeBig   = "big"   // arbitrary-precision decimals
+)
+
+// Precision limits, in significant digits
+const (
+	maxFloatDigits   = 17
+	maxBigDigits     = 100
+	defaultBigDigits = 30
+	maxExactDigits   = 100 // longer exact results are shown in scientific notation
+)
+
+// calculate evaluates a parse tree in the given mode. It returns the result
+// formatted for the model, and its value as a fraction so later expressions
+// can use it in any mode. vars holds the names the expression may use besides
+// pi and e.
+//
+// precision is the number of significant digits in the result, 0 for the
+// mode's default: the shortest exact decimal for float, the bare fraction
+// for exact.
+func calculate(root *exprNode, mode string, precision int, vars map[string]*big.Rat) (string, *big.Rat, error) {
+	if precision < 0 || precision > maxBigDigits {
+		return "", nil, fmt.Errorf("precision must be between 1 and %d significant digits", maxBigDigits)
+	}
+
+	switch mode {
+	case "", modeFloat:
+		value, err := evalNode[float64](root, floatMath{}, vars)
+		if err != nil {
+			return "", nil, err
+		}
+		// the shortest decimal that round-trips, so 0.1 is saved as 1/10
+		saved, _ := new(big.Rat).SetString(strconv.FormatFloat(value, 'g', -1, 64))
+		digits := -1 // shortest that round-trips, so 1e-5 doesn't show as 0.00
+		if precision > 0 {
+			digits = min(precision, maxFloatDigits)
+		}
+		return strconv.FormatFloat(value, 'g', digits, 64), saved, nil
+
+	case modeExact:
+		value, err := evalNode[*big.Rat](root, ratMath{}, vars)
+		if err != nil {
+			return "", nil, err
+		}
+		return formatRat(value, precision), value, nil
+
+	case modeBig:
+		if precision == 0 {
+			precision = defaultBigDigits
+		}
+		value, err := evalNode[*big.Float](root, newBigFloatMath(precision), vars)
+		if err != nil {
+			return "", nil, err
+		}
+		if value.IsInf() {
+			return "", nil, calcErrorAt(ErrOverflow, 1, "the result is too large even for big mode")
+		}
+		text := value.Text('g', precision)
+		saved, _ := new(big.Rat).SetString(text)
+		return text, saved, nil
+	}
+	return "", nil, fmt.Errorf("unknown mode '%s', use %s, %s or %s", mode, modeFloat, modeExact, modeBig)
+}
+
+// calcNumbers is the arithmetic an expression is evaluated with, so the same
+// parse tree can be computed as float64, exact rationals or big floats
+type calcNumbers[T any] interface {
+	number(tok mathToken) (T, error)
+	constant(tok mathToken) (T, error)
+	fromRat(tok mathToken, r *big.Rat) (T, error)
+	negate(x T) T
+	binary(op mathToken, a, b T) (T, error)
+	call(fn mathToken, args []T) (T, error)
+}
+
+// evalNode computes a parse tree bottom-up
+func evalNode[T any](n *exprNode, nums calcNumbers[T], vars map[string]*big.Rat) (T, error) {
+	switch n.kind {
+	case nodeNumber:
+		return nums.number(n.tok)
+	case nodeName:
+		if _, ok := mathConstants[strings.ToLower(n.tok.text)]; ok {
+			return nums.constant(n.tok)
+		}
+		if value, ok := vars[n.tok.text]; ok {
+			return nums.fromRat(n.tok, value)
+		}
+		var zero T
+		return zero, unknownNameError(n.tok, vars)
+	}
+
+	args := make([]T, len(n.args))
+	for i, arg := range n.args {
+		v, err := evalNode(arg, nums, vars)
+		if err != nil {
+			return v, err
+		}
+		args[i] = v
+	}
+	switch n.kind {
+	case nodeNegate:
+		return nums.negate(args[0]), nil
+	case nodeBinary:
+		return nums.binary(n.tok, args[0], args[1])
+	default:
+		return nums.call(n.tok, args)
+	}
+}
+
+// unknownNameError lists the names that do exist, so the model can pick one
+func unknownNameError(tok mathToken, vars map[string]*big.Rat) error {
+	var names []string
+	for name := range vars {
+		if !strings.HasPrefix(name, "$") && name != "ans" {
+			names = append(names, name)
+		}
+	}
+	if strings.HasPrefix(tok.text, "$") || tok.text == "ans" {
+		return calcErrorAt(ErrUnknownToken, tok.pos, "there is no result %s yet", tok.text)
+	}
+	if len(names) == 0 {
+		return calcErrorAt(ErrUnknownToken, tok.pos,
+			"unknown name '%s', known constants are pi and e, and no variables are set (assign one with %s = ...)", tok.text, tok.text)
+	}
+	sort.Strings(names)
+	return calcErrorAt(ErrUnknownToken, tok.pos, "unknown name '%s', known constants are pi and e, variables are %s",
+		tok.text, strings.Join(names, ", "))
+}
+
+/* ------------------------------------------------------------------------
+   ERRORS
+   ------------------------------------------------------------------------ */
+
+// CalcErrorKind says what class of problem an expression has
+type CalcErrorKind string
+
+const (
+	ErrUnknownToken     CalcErrorKind = "unknown token"
+	ErrUnbalancedParens CalcErrorKind = "unbalanced parentheses"
+	ErrDivisionByZero   CalcErrorKind = "division by zero"
+	ErrOverflow         CalcErrorKind = "overflow"
+	ErrUnderflow        CalcErrorKind = "underflow"
+	ErrDomain           CalcErrorKind = "domain error"
+	ErrSyntax           CalcErrorKind = "syntax error"
+)
+
+// CalcError is a problem in an expression. Pos is the 1-based character
+// position it was found at, so the model can fix that part of the input.
+type CalcError struct {
+	Kind CalcErrorKind
+	Pos  int
+	Msg  string
+}
+
+func (e *CalcError) Error() string {
+	return fmt.Sprintf("%s at position %d: %s", e.Kind, e.Pos, e.Msg)
+}
+
+func calcErrorAt(kind CalcErrorKind, pos int, format string, args ...interface{}) error {
+	return &CalcError{Kind: kind, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// checkResult turns NaN, infinite and underflowed results into errors,
+// instead of handing "NaN", "+Inf" or a bogus 0 to the model as an answer.
+// nonzero says the exact result can't be 0, so a 0 means it underflowed.
+// Poles like log(0) are caught before this as domain errors, so Inf here is
+// always overflow.
+func checkResult(value float64, pos int, what string, nonzero bool) (float64, error) {
+	switch {
+	case math.IsNaN(value):
+		return 0, calcErrorAt(ErrDomain, pos, "%s is undefined for these values", what)
+	case math.IsInf(value, 0):
+		return 0, calcErrorAt(ErrOverflow, pos, "%s is too large for float64, use mode exact or big", what)
+	case value == 0 && nonzero:
+		return 0, calcErrorAt(ErrUnderflow, pos, "%s is too small for float64, use mode exact or big", what)
+	}
+	return value, nil
+}
+
+/* ------------------------------------------------------------------------
+   FLOAT64 ARITHMETIC
+   ------------------------------------------------------------------------ */
+
+// floatMath evaluates with float64, and is the only mode with the
+// transcendental functions
+type floatMath struct{}
+
+func (floatMath) number(tok mathToken) (float64, error) {
+	value, err := strconv.ParseFloat(tok.text, 64)
+	if err != nil {
+		return 0, calcErrorAt(ErrOverflow, tok.pos, "'%s' is too large for float64, use mode exact or big", tok.text)
+	}
+	// ParseFloat rounds 1e-400 to 0 without complaint
+	mantissa, _, _ := strings.Cut(strings.ToLower(tok.text), "e")
+	return checkResult(value, tok.pos, "'"+tok.text+"'", strings.ContainsAny(mantissa, "123456789"))
+}
+
+func (floatMath) constant(tok mathToken) (float64, error) {
+	return mathConstants[strings.ToLower(tok.text)], nil
+}
+
+// fromRat converts a session value, which may have come from exact or big
+// mode and not fit in a float64
+func (floatMath) fromRat(tok mathToken, r *big.Rat) (float64, error) {
+	value, _ := r.Float64()
+	return checkResult(value, tok.pos, "'"+tok.text+"'", r.Sign() != 0)
+}
+
+func (floatMath) negate(x float64) float64 { return -x }
+
+func (floatMath) binary(op mathToken, a, b float64) (float64, error) {
+	var result float64
+	switch op.text {
+	case "+":
+		result = a + b
+	case "-":
+		result = a - b
+	case "*":
+		result = a * b
+	case "/", "%":
+		if b == 0 {
+			return 0, calcErrorAt(ErrDivisionByZero, op.pos, "the right side of '%s' is zero", op.text)
+		}
+		if op.text == "/" {
+			result = a / b
+		} else {
+			result = math.Mod(a, b)
+		}
+	case "^":
+		if a == 0 && b < 0 {
+			return 0, calcErrorAt(ErrDivisionByZero, op.pos, "zero to a negative power")
+		}
+		result = math.Pow(a, b)
+	}
+	// a product, quotient or power of nonzero numbers is only 0 by underflow
+	nonzero := false
+	switch op.text {
+	case "*":
+		nonzero = a != 0 && b != 0
+	case "/", "^":
+		nonzero = a != 0
+	}
+	return checkResult(result, op.pos, "the result of '"+op.text+"'", nonzero)
+}
+
+func (floatMath) call(fn mathToken, args []float64) (float64, error) {
+	name := strings.ToLower(fn.text)
+	switch name {
+	case "log", "ln", "log10", "log2":
+		if args[0] == 0 {
+			return 0, calcErrorAt(ErrDomain, fn.pos, "%s() of 0 is undefined", name)
+		}
+	case "pow":
+		if args[0] == 0 && args[1] < 0 {
+			return 0, calcErrorAt(ErrDivisionByZero, fn.pos, "zero to a negative power")
+		}
+	}
+	// exp is never 0, and pow only for a base of 0
+	nonzero := name == "exp" || (name == "pow" && args[0] != 0)
+	return checkResult(mathFunctions[name].fn(args), fn.pos, name+"()", nonzero)
+}
+
+// mathFunction is a function callable from an expression, with its arity
+type mathFunction struct {
+	minArgs, maxArgs int // maxArgs -1 means any number
+	fn               func(args []float64) float64
+}
+
+func unary(f func(float64) float64) mathFunction {
+	return mathFunction{1, 1, func(args []float64) float64 { return f(args[0]) }}
+}
+
+// mathFunctions are the functions expressions may call. Trig uses radians,
+// log is the natural logarithm.
+var mathFunctions = map[string]mathFunction{
+	"sqrt":  unary(math.Sqrt),
+	"cbrt":  unary(math.Cbrt),
+	"abs":   unary(math.Abs),
+	"exp":   unary(math.Exp),
+	"log":   unary(math.Log),
+	"ln":    unary(math.Log),
+	"log10": unary(math.Log10),
+	"log2":  unary(math.Log2),
+	"sin":   unary(math.Sin),
+	"cos":   unary(math.Cos),
+	"tan":   unary(math.Tan),
+	"asin":  unary(math.Asin),
+	"acos":  unary(math.Acos),
+	"atan":  unary(math.Atan),
+	"floor": unary(math.Floor),
+	"ceil":  unary(math.Ceil),
+	"round": unary(math.Round),
+	"pow":   {2, 2, func(args []float64) float64 { return math.Pow(args[0], args[1]) }},
+	"min": {1, -1, func(args []float64) float64 {
+		result := args[0]
+		for _, a := range args[1:] {
+			result = math.Min(result, a)
+		}
+		return result
+	}},
+	"max": {1, -1, func(args []float64) float64 {
+		result := args[0]
+		for _, a := range args[1:] {
+			result = math.Max(result, a)
+		}
+		return result
+	}},
+}
+
+// mathConstants are the named values expressions may use
+var mathConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+/* ------------------------------------------------------------------------
+   TOKENIZER
+   ------------------------------------------------------------------------ */
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokOp     // + - * / % ^
+	tokLParen // (
+	tokRParen // )
+	tokComma
+	tokAssign // =
+)
+
+type mathToken struct {
+	kind tokenKind
+	text string
+	pos  int // 1-based character position in the expression
+}
+
+// tokenize splits an expression into numbers, names, operators and parentheses
+func tokenize(expression string) ([]mathToken, error) {
+	var tokens []mathToken
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+
+		case unicode.IsDigit(r) || r == '.':
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			// exponent, only if digits follow, so "2e" stays 2 followed by e
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				j := i + 1
+				if j < len(runes) && (runes[j] == '+' || runes[j] == '-') {
+					j++
+				}
+				if j < len(runes) && unicode.IsDigit(runes[j]) {
+					for j < len(runes) && unicode.IsDigit(runes[j]) {
+						j++
+					}
+					i = j
+				}
+			}
+			text := string(runes[start:i])
+			if _, err := strconv.ParseFloat(text, 64); errors.Is(err, strconv.ErrSyntax) {
+				return nil, calcErrorAt(ErrUnknownToken, start+1, "invalid number '%s'", text)
+			}
+			tokens = append(tokens, mathToken{kind: tokNumber, text: text, pos: start + 1})
+			continue
+
+		case unicode.IsLetter(r) || r == '_':
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, mathToken{kind: tokIdent, text: string(runes[start:i]), pos: start + 1})
+			continue
+
+		case r == '$':
+			// $1, $2, ... are earlier results
+			for i++; i < len(runes) && unicode.IsDigit(runes[i]); i++ {
+			}
+			if i == start+1 {
+				return nil, calcErrorAt(ErrUnknownToken, start+1, "'$' must be followed by a result number, e.g. $1")
+			}
+			tokens = append(tokens, mathToken{kind: tokIdent, text: string(runes[start:i]), pos: start + 1})
+			continue
+
+		case strings.ContainsRune("+-*/%^", r):
+			tokens = append(tokens, mathToken{kind: tokOp, text: string(r), pos: start + 1})
+		case r == '(':
+			tokens = append(tokens, mathToken{kind: tokLParen, text: "(", pos: start + 1})
+		case r == ')':
+			tokens = append(tokens, mathToken{kind: tokRParen, text: ")", pos: start + 1})
+		case r == ',':
+			tokens = append(tokens, mathToken{kind: tokComma, text: ",", pos: start + 1})
+		case r == '=':
+			tokens = append(tokens, mathToken{kind: tokAssign, text: "=", pos: start + 1})
+		default:
+			return nil, calcErrorAt(ErrUnknownToken, start+1, "unknown character '%c'", r)
+		}
+		i++
+	}
+	return append(tokens, mathToken{kind: tokEOF, text: "end of expression", pos: len(runes) + 1}), nil
+}
+
+/* ------------------------------------------------------------------------
+   PARSER (precedence climbing)
+   ------------------------------------------------------------------------ */
+
+// binary operator precedence; unary minus binds tighter than * but looser
+// than ^, so -2^2 = -4 and 2*-3 = -6
+var precedence = map[string]int{"+": 1, "-": 1, "*": 2, "/": 2, "%": 2, "^": 4}
+
+const unaryPrecedence = 3
+
+type nodeKind int
+
+const (
+	nodeNumber nodeKind = iota // tok is the literal
+	nodeName                   // a constant, variable or earlier result; tok is the name
+	nodeNegate                 // args[0] is the operand
+	nodeBinary                 // tok is the operator, args the operands
+	nodeCall                   // tok is the function name
+)
+
+// exprNode is a node of the parse tree
+type exprNode struct {
+	kind nodeKind
+	tok  mathToken
+	args []*exprNode
+}
+
+// parseStatement parses "expression" or "name = expression", returning the
+// assigned name if there is one. Function names and arities are checked
+// here; names are looked up when the tree is evaluated.
+func parseStatement(statement string) (string, *exprNode, error) {
+	tokens, err := tokenize(statement)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var target string
+	if len(tokens) > 2 && tokens[0].kind == tokIdent && tokens[1].kind == tokAssign {
+		if err := checkVariableName(tokens[0]); err != nil {
+			return "", nil, err
+		}
+		target = tokens[0].text
+		tokens = tokens[2:]
+	}
+
+	p := &mathParser{tokens: tokens}
+	root, err := p.parseExpr(0)
+	if err != nil {
+		return "", nil, err
+	}
+	switch tok := p.peek(); tok.kind {
+	case tokEOF:
+		return target, root, nil
+	case tokRParen:
+		return "", nil, calcErrorAt(ErrUnbalancedParens, tok.pos, "')' has no matching '('")
+	case tokAssign:
+		return "", nil, calcErrorAt(ErrSyntax, tok.pos, "only a single variable name can go left of '=', e.g. x = 3*4")
+	default:
+		return "", nil, calcErrorAt(ErrSyntax, tok.pos, "unexpected '%s', expected an operator", tok.text)
+	}
+}
+
+// checkVariableName rejects assignments that would hide a constant,
+// function or result reference
+func checkVariableName(tok mathToken) error {
+	name := strings.ToLower(tok.text)
+	_, isConstant := mathConstants[name]
+	_, isFunction := mathFunctions[name]
+	if isConstant || isFunction || name == "ans" || strings.HasPrefix(name, "$") {
+		return calcErrorAt(ErrSyntax, tok.pos, "'%s' is reserved and can't be assigned, pick another name", tok.text)
+	}
+	return nil
+}
+
+type mathParser struct {
+	tokens []mathToken
+	pos    int
+}
+
+func (p *mathParser) peek() mathToken { return p.tokens[p.pos] }
+
+func (p *mathParser) next() mathToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// parseExpr parses operators binding at least as tightly as minPrec
+func (p *mathParser) parseExpr(minPrec int) (*exprNode, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		prec, isOp := precedence[tok.text]
+		if tok.kind != tokOp || !isOp || prec < minPrec {
+			return lhs, nil
+		}
+		p.next()
+
+		// ^ is right associative, everything else left associative
+		nextMin := prec + 1
+		if tok.text == "^" {
+			nextMin = prec
+		}
+		rhs, err := p.parseExpr(nextMin)
+		if err != nil {
+			return nil, err
+		}
+		lhs = &exprNode{kind: nodeBinary, tok: tok, args: []*exprNode{lhs, rhs}}
+	}
+}
+
+func (p *mathParser) parseUnary() (*exprNode, error) {
+	if tok := p.peek(); tok.kind == tokOp && (tok.text == "-" || tok.text == "+") {
+		p.next()
+		operand, err := p.parseExpr(unaryPrecedence)
+		if err != nil {
+			return nil, err
+		}
+		if tok.text == "-" {
+			return &exprNode{kind: nodeNegate, tok: tok, args: []*exprNode{operand}}, nil
+		}
+		return operand, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *mathParser) parsePrimary() (*exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		return &exprNode{kind: nodeNumber, tok: tok}, nil
+
+	case tokLParen:
+		inner, err := p.parseExpr(0)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectClose(tok); err != nil {
+			return nil, err
+		}
+		return inner, nil
+
+	case tokIdent:
+		if p.peek().kind == tokLParen {
+			return p.parseCall(tok)
+		}
+		return &exprNode{kind: nodeName, tok: tok}, nil
+
+	case tokRParen:
+		return nil, calcErrorAt(ErrUnbalancedParens, tok.pos, "')' has no matching '(' or nothing before it")
+	case tokEOF:
+		return nil, calcErrorAt(ErrSyntax, tok.pos, "the expression ends where a number was expected")
+	}
+	return nil, calcErrorAt(ErrSyntax, tok.pos, "unexpected '%s', expected a number", tok.text)
+}
+
+// expectClose consumes the ')' matching open
+func (p *mathParser) expectClose(open mathToken) error {
+	switch closing := p.next(); closing.kind {
+	case tokRParen:
+		return nil
+	case tokEOF:
+		return calcErrorAt(ErrUnbalancedParens, open.pos, "'(' is never closed")
+	default:
+		return calcErrorAt(ErrSyntax, closing.pos, "unexpected '%s', expected ')' to close '(' at position %d", closing.text, open.pos)
+	}
+}
+
+// parseCall parses a function call's arguments, with the name already consumed
+func (p *mathParser) parseCall(nameTok mathToken) (*exprNode, error) {
+	name := strings.ToLower(nameTok.text)
+	fn, ok := mathFunctions[name]
+	if !ok {
+		return nil, calcErrorAt(ErrUnknownToken, nameTok.pos, "unknown function '%s'", nameTok.text)
+	}
+	open := p.next()
+
+	call := &exprNode{kind: nodeCall, tok: nameTok}
+	if p.peek().kind != tokRParen {
+		for {
+			arg, err := p.parseExpr(0)
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if err := p.expectClose(open); err != nil {
+		return nil, err
+	}
+
+	if n := len(call.args); n < fn.minArgs || (fn.maxArgs >= 0 && n > fn.maxArgs) {
+		return nil, calcErrorAt(ErrSyntax, nameTok.pos, "%s() takes %s, got %d", name, arityText(fn), n)
+	}
+	return call, nil
+}
+
+func arityText(fn mathFunction) string {
+	switch {
+	case fn.maxArgs < 0:
+		return fmt.Sprintf("at least %d arguments", fn.minArgs)
+	case fn.minArgs == fn.maxArgs && fn.minArgs == 1:
+		return "1 argument"
+	case fn.minArgs == fn.maxArgs:
+		return fmt.Sprintf("%d arguments", fn.minArgs)
+	}
+	return fmt.Sprintf("%d to %d arguments", fn.minArgs, fn.maxArgs)
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+/* ------------------------------------------------------------------------
+   EXACT AND ARBITRARY-PRECISION ARITHMETIC
+   ------------------------------------------------------------------------ */
+
+// Size limits, so a short expression like 9^9^9 can't eat all the memory
+const (
+	maxLiteralExponent = 10000   // the 400 in 1e400
+	maxResultBits      = 1 << 20 // about 315,000 decimal digits
+)
+
+// pi and e to more digits than maxBigDigits needs
+const (
+	piDigits = "3.14159265358979323846264338327950288419716939937510582097494459230781640628620899862803482534211706798"
+	eDigits  = "2.71828182845904523536028747135266249775724709369995957496696762772407663035354759457138217852516642742"
+)
+
+// exactFunctions are the functions with exact rational results; the others
+// only exist in float mode. sqrt is here too, but only for perfect squares.
+var exactFunctions = map[string]func(args []*big.Rat) *big.Rat{
+	"abs":   func(args []*big.Rat) *big.Rat { return new(big.Rat).Abs(args[0]) },
+	"floor": func(args []*big.Rat) *big.Rat { return ratFloor(args[0]) },
+	"ceil":  func(args []*big.Rat) *big.Rat { return ratNeg(ratFloor(ratNeg(args[0]))) },
+	"round": func(args []*big.Rat) *big.Rat { return ratRound(args[0]) },
+	"min": func(args []*big.Rat) *big.Rat {
+		result := args[0]
+		for _, a := range args[1:] {
+			if a.Cmp(result) < 0 {
+				result = a
+			}
+		}
+		return result
+	},
+	"max": func(args []*big.Rat) *big.Rat {
+		result := args[0]
+		for _, a := range args[1:] {
+			if a.Cmp(result) > 0 {
+				result = a
+			}
+		}
+		return result
+	},
+}
+
+// ratMath evaluates with exact fractions, for money math and large integers
+type ratMath struct{}
+
+func (ratMath) number(tok mathToken) (*big.Rat, error) {
+	if err := checkLiteralExponent(tok); err != nil {
+		return nil, err
+	}
+	value, ok := new(big.Rat).SetString(tok.text)
+	if !ok {
+		return nil, calcErrorAt(ErrUnknownToken, tok.pos, "invalid number '%s'", tok.text)
+	}
+	return value, nil
+}
+
+func (ratMath) constant(tok mathToken) (*big.Rat, error) {
+	return nil, calcErrorAt(ErrDomain, tok.pos, "%s is irrational and has no exact value, use mode big or float", tok.text)
+}
+
+func (ratMath) fromRat(tok mathToken, r *big.Rat) (*big.Rat, error) { return r, nil }
+
+func (ratMath) negate(x *big.Rat) *big.Rat { return ratNeg(x) }
+
+func (ratMath) binary(op mathToken, a, b *big.Rat) (*big.Rat, error) {
+	switch op.text {
+	case "+":
+		return new(big.Rat).Add(a, b), nil
+	case "-":
+		return new(big.Rat).Sub(a, b), nil
+	case "*":
+		return checkRatSize(new(big.Rat).Mul(a, b), op)
+	case "/", "%":
+		if b.Sign() == 0 {
+			return nil, calcErrorAt(ErrDivisionByZero, op.pos, "the right side of '%s' is zero", op.text)
+		}
+		if op.text == "/" {
+			return checkRatSize(new(big.Rat).Quo(a, b), op)
+		}
+		return ratMod(a, b), nil
+	}
+	return ratPow(op, a, b)
+}
+
+func (m ratMath) call(fn mathToken, args []*big.Rat) (*big.Rat, error) {
+	name := strings.ToLower(fn.text)
+	switch name {
+	case "pow":
+		return ratPow(fn, args[0], args[1])
+	case "sqrt":
+		if root, ok := ratSqrt(args[0]); ok {
+			return root, nil
+		}
+		return nil, calcErrorAt(ErrDomain, fn.pos, "sqrt(%s) has no exact value, use mode big or float", args[0].RatString())
+	}
+	if f, ok := exactFunctions[name]; ok {
+		return f(args), nil
+	}
+	return nil, calcErrorAt(ErrDomain, fn.pos, "%s() has no exact result, use mode float", name)
+}
+
+// bigFloatMath evaluates with big.Float at enough bits for the requested
+// number of significant digits
+type bigFloatMath struct {
+	prec uint
+}
+
+func newBigFloatMath(digits int) bigFloatMath {
+	return bigFloatMath{prec: bitsForDigits(digits)}
+}
+
+func (m bigFloatMath) number(tok mathToken) (*big.Float, error) {
+	if err := checkLiteralExponent(tok); err != nil {
+		return nil, err
+	}
+	value, _, err := big.ParseFloat(tok.text, 10, m.prec, big.ToNearestEven)
+	if err != nil {
+		return nil, calcErrorAt(ErrUnknownToken, tok.pos, "invalid number '%s'", tok.text)
+	}
+	return value, nil
+}
+
+func (m bigFloatMath) constant(tok mathToken) (*big.Float, error) {
+	digits := piDigits
+	if strings.ToLower(tok.text) == "e" {
+		digits = eDigits
+	}
+	value, _, _ := big.ParseFloat(digits, 10, m.prec, big.ToNearestEven)
+	return value, nil
+}
+
+func (m bigFloatMath) negate(x *big.Float) *big.Float { return m.new().Neg(x) }
+
+// binary checks every result for overflow: big.Float saturates to ±Inf,
+// and Inf - Inf or Inf * 0 would panic further up the expression
+func (m bigFloatMath) binary(op mathToken, a, b *big.Float) (*big.Float, error) {
+	switch op.text {
+	case "+":
+		return checkBigFloat(m.new().Add(a, b), op)
+	case "-":
+		return checkBigFloat(m.new().Sub(a, b), op)
+	case "*":
+		return checkBigFloat(m.new().Mul(a, b), op)
+	case "/", "%":
+		if b.Sign() == 0 {
+			return nil, calcErrorAt(ErrDivisionByZero, op.pos, "the right side of '%s' is zero", op.text)
+		}
+		if op.text == "/" {
+			return checkBigFloat(m.new().Quo(a, b), op)
+		}
+		ra, err := m.toRat(op, a)
+		if err != nil {
+			return nil, err
+		}
+		rb, err := m.toRat(op, b)
+		if err != nil {
+			return nil, err
+		}
+		return m.new().SetRat(ratMod(ra, rb)), nil
+	}
+	return m.pow(op, a, b)
+}
+
+func (m bigFloatMath) call(fn mathToken, args []*big.Float) (*big.Float, error) {
+	name := strings.ToLower(fn.text)
+	switch name {
+	case "pow":
+		return m.pow(fn, args[0], args[1])
+	case "sqrt":
+		if args[0].Sign() < 0 {
+			return nil, calcErrorAt(ErrDomain, fn.pos, "sqrt() of a negative number is undefined")
+		}
+		return m.new().Sqrt(args[0]), nil
+	}
+	if f, ok := exactFunctions[name]; ok {
+		rats := make([]*big.Rat, len(args))
+		for i, a := range args {
+			r, err := m.toRat(fn, a)
+			if err != nil {
+				return nil, err
+			}
+			rats[i] = r
+		}
+		return m.new().SetRat(f(rats)), nil
+	}
+	return nil, calcErrorAt(ErrDomain, fn.pos, "%s() isn't available with arbitrary precision, use mode float", name)
+}
+
+// pow supports whole-number exponents, by repeated squaring
+func (m bigFloatMath) pow(op mathToken, base, exponent *big.Float) (*big.Float, error) {
+	r, err := m.toRat(op, exponent)
+	if err != nil {
+		return nil, err
+	}
+	n, err := intExponent(op, r)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 && base.Sign() == 0 {
+		return nil, calcErrorAt(ErrDivisionByZero, op.pos, "zero to a negative power")
+	}
+	result, square := m.new().SetInt64(1), m.new().Set(base)
+	for e := abs(n); e > 0; e >>= 1 {
+		if e&1 == 1 {
+			if _, err := checkBigFloat(result.Mul(result, square), op); err != nil {
+				return nil, err
+			}
+		}
+		if e > 1 {
+			if _, err := checkBigFloat(square.Mul(square, square), op); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if n < 0 {
+		// a tiny base can underflow to 0, and 1/0 would be Inf
+		if result.Sign() == 0 {
+			return nil, calcErrorAt(ErrOverflow, op.pos, "the result of '%s' is too large even for big mode", op.text)
+		}
+		return checkBigFloat(result.Quo(m.new().SetInt64(1), result), op)
+	}
+	return result, nil
+}
+
+func (m bigFloatMath) new() *big.Float { return new(big.Float).SetPrec(m.prec) }
+
+// toRat converts x for the exact helpers, refusing values whose fraction
+// would be larger than exact mode allows (and Inf, which has none)
+func (m bigFloatMath) toRat(op mathToken, x *big.Float) (*big.Rat, error) {
+	if x.IsInf() || abs(int64(x.MantExp(nil))) > maxResultBits {
+		return nil, calcErrorAt(ErrOverflow, op.pos, "the operand of '%s' is too large to compute exactly", op.text)
+	}
+	r, _ := x.Rat(nil)
+	return r, nil
+}
+
+func (m bigFloatMath) fromRat(tok mathToken, r *big.Rat) (*big.Float, error) {
+	return m.new().SetRat(r), nil
+}
+
+// checkBigFloat turns a result that overflowed to ±Inf into an error
+func checkBigFloat(x *big.Float, op mathToken) (*big.Float, error) {
+	if x.IsInf() {
+		return nil, calcErrorAt(ErrOverflow, op.pos, "the result of '%s' is too large even for big mode", op.text)
+	}
+	return x, nil
+}
+
+/* --- helpers --- */
+
+// ratPow raises a to a whole-number power, exactly
+func ratPow(op mathToken, a, b *big.Rat) (*big.Rat, error) {
+	n, err := intExponent(op, b)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 && a.Sign() == 0 {
+		return nil, calcErrorAt(ErrDivisionByZero, op.pos, "zero to a negative power")
+	}
+	if int64(a.Num().BitLen()+a.Denom().BitLen())*abs(n) > maxResultBits {
+		return nil, calcErrorAt(ErrOverflow, op.pos, "the result of '%s' would have more than %d bits", op.text, maxResultBits)
+	}
+	e := big.NewInt(abs(n))
+	num := new(big.Int).Exp(a.Num(), e, nil)
+	den := new(big.Int).Exp(a.Denom(), e, nil)
+	if n < 0 {
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+// intExponent returns b as an int64 if it's a whole number of sensible size
+func intExponent(op mathToken, b *big.Rat) (int64, error) {
+	if !b.IsInt() || !b.Num().IsInt64() {
+		return 0, calcErrorAt(ErrDomain, op.pos,
+			"only whole-number powers are supported in this mode, got %s; use sqrt() or mode float", b.RatString())
+	}
+	n := b.Num().Int64()
+	if abs(n) > maxResultBits {
+		return 0, calcErrorAt(ErrOverflow, op.pos, "the exponent %d is too large", n)
+	}
+	return n, nil
+}
+
+func checkRatSize(r *big.Rat, op mathToken) (*big.Rat, error) {
+	if r.Num().BitLen()+r.Denom().BitLen() > maxResultBits {
+		return nil, calcErrorAt(ErrOverflow, op.pos, "the result of '%s' has more than %d bits", op.text, maxResultBits)
+	}
+	return r, nil
+}
+
+// checkLiteralExponent rejects literals like 1e99999999, which would take
+// forever to expand into an exact or big number
+func checkLiteralExponent(tok mathToken) error {
+	i := strings.IndexAny(tok.text, "eE")
+	if i == -1 {
+		return nil
+	}
+	exp, err := strconv.Atoi(tok.text[i+1:])
+	if err != nil || abs(int64(exp)) > maxLiteralExponent {
+		return calcErrorAt(ErrOverflow, tok.pos, "the exponent in '%s' is too large, the limit is %d", tok.text, maxLiteralExponent)
+	}
+	return nil
+}
+
+func ratNeg(x *big.Rat) *big.Rat { return new(big.Rat).Neg(x) }
+
+// ratFloor rounds down; big.Int.Div is Euclidean, which is floor for a
+// positive divisor, and a Rat's denominator is always positive
+func ratFloor(x *big.Rat) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Div(x.Num(), x.Denom()))
+}
+
+// ratRound rounds half away from zero, like math.Round
+func ratRound(x *big.Rat) *big.Rat {
+	half := big.NewRat(1, 2)
+	if x.Sign() < 0 {
+		return ratNeg(ratFloor(new(big.Rat).Add(ratNeg(x), half)))
+	}
+	return ratFloor(new(big.Rat).Add(x, half))
+}
+
+// ratMod is the remainder with the sign of a, like math.Mod
+func ratMod(a, b *big.Rat) *big.Rat {
+	q := new(big.Rat).Quo(a, b)
+	trunc := new(big.Int).Quo(q.Num(), q.Denom())
+	return new(big.Rat).Sub(a, new(big.Rat).Mul(b, new(big.Rat).SetInt(trunc)))
+}
+
+// ratSqrt returns the exact square root if both parts are perfect squares
+func ratSqrt(x *big.Rat) (*big.Rat, bool) {
+	if x.Sign() < 0 {
+		return nil, false
+	}
+	num, den := new(big.Int).Sqrt(x.Num()), new(big.Int).Sqrt(x.Denom())
+	root := new(big.Rat).SetFrac(num, den)
+	if new(big.Rat).Mul(root, root).Cmp(x) != 0 {
+		return nil, false
+	}
+	return root, true
+}
+
+// formatRat shows a fraction like 1/3, or a whole number, followed by its
+// decimal value to the given significant digits if precision is set. A
+// fraction longer than maxExactDigits is only shown in scientific notation,
+// so 1e5000 doesn't put 5001 digits into the conversation.
+func formatRat(r *big.Rat, precision int) string {
+	text := r.RatString()
+	if len(text) > maxExactDigits {
+		if precision == 0 {
+			precision = defaultBigDigits
+		}
+		decimal := new(big.Float).SetPrec(bitsForDigits(precision)).SetRat(r)
+		return fmt.Sprintf("≈ %s (the exact value has %d digits; it is kept exactly for later calculations)",
+			decimal.Text('g', precision), len(text)-strings.Count(text, "-")-strings.Count(text, "/"))
+	}
+	if precision == 0 || r.IsInt() {
+		return text
+	}
+	decimal := new(big.Float).SetPrec(bitsForDigits(precision)).SetRat(r)
+	return text + " ≈ " + decimal.Text('g', precision)
+}
+
+// bitsForDigits is the big.Float precision for a number of decimal digits,
+// with some guard bits so the last digit shown is right
+func bitsForDigits(digits int) uint {
+	return uint(math.Ceil(float64(digits)*math.Log2(10))) + 16
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+/* ------------------------------------------------------------------------
+   CALCULATOR SESSION
+   ------------------------------------------------------------------------ */
+
+// CalcSession is the calculator state for one conversation: named variables
+// set with "x = 3*4", and every result so far, which expressions refer to as
+// $1, $2, ... or ans for the latest. Values are kept as exact fractions so a
+// result from one mode can be used in another.
+type CalcSession struct {
+	vars    map[string]*big.Rat
+	results []*big.Rat
+}
+
+// NewCalcSession returns a session with no variables or results
+func NewCalcSession() *CalcSession {
+	return &CalcSession{vars: map[string]*big.Rat{}}
+}
+
+// Solve evaluates an expression or assignment and records the result. The
+// answer says how to refer to it later, e.g. "$3 = 12.00" or "x = $3 = 12.00".
+// Failed calculations change nothing.
+func (s *CalcSession) Solve(statement, mode string, precision int) (string, error) {
+	target, root, err := parseStatement(statement)
+	if err != nil {
+		return "", err
+	}
+	text, value, err := calculate(root, mode, precision, s.scope())
+	if err != nil {
+		return "", err
+	}
+
+	s.results = append(s.results, value)
+	ref := fmt.Sprintf("$%d", len(s.results))
+	if target == "" {
+		return ref + " = " + text, nil
+	}
+	s.vars[target] = value
+	return target + " = " + ref + " = " + text, nil
+}
+
+// scope is every name an expression can use: the variables, $1..$n and ans
+func (s *CalcSession) scope() map[string]*big.Rat {
+	scope := make(map[string]*big.Rat, len(s.vars)+len(s.results)+1)
+	for name, value := range s.vars {
+		scope[name] = value
+	}
+	for i, value := range s.results {
+		scope[fmt.Sprintf("$%d", i+1)] = value
+	}
+	if n := len(s.results); n > 0 {
+		scope["ans"] = s.results[n-1]
+	}
+	return scope
+}
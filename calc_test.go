@@ -0,0 +1,143 @@
+package main
+
+import "testing"
+
+// evalFloat parses and evaluates an expression in float mode at full precision
+func evalFloat(expression string) (string, error) {
+	_, root, err := parseStatement(expression)
+	if err != nil {
+		return "", err
+	}
+	text, _, err := calculate(root, modeFloat, 0, nil)
+	return text, err
+}
+
+func TestCalculateFloat(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3", "9"},
+		{"2*-3", "-6"},
+		{"-2^2", "-4"},
+		{"2^3^2", "512"},
+		{"--3", "3"},
+		{"+4", "4"},
+		{"1e-5", "1e-05"},
+		{"1e-5 + 2E+3", "2000.00001"},
+		{"10 % 4", "2"},
+		{"-7 % 3", "-1"},
+		{"1/3", "0.3333333333333333"},
+		{"(1/3)*3", "1"},
+		{"sqrt(16)", "4"},
+		{"log(e)", "1"},
+		{"log10(1000)", "3"},
+		{"min(3, -1, 2)", "-1"},
+		{"max(3, -1, 2)", "3"},
+		{"abs(-2.5)", "2.5"},
+		{"pow(2, 10)", "1024"},
+		{"round(sin(pi/2))", "1"},
+		{"0.1 + 0.2", "0.30000000000000004"},
+	}
+	for _, tt := range tests {
+		got, err := evalFloat(tt.expression)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.expression, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.expression, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateFloatRange(t *testing.T) {
+	tests := []struct {
+		expression string
+		kind       CalcErrorKind
+	}{
+		{"1e400", ErrOverflow},
+		{"1e308 * 10", ErrOverflow},
+		{"exp(1000)", ErrOverflow},
+		{"1e-400", ErrUnderflow},
+		{"5e-324 / 2", ErrUnderflow},
+		{"1e-200 * 1e-200", ErrUnderflow},
+		{"10^-400", ErrUnderflow},
+		{"exp(-1000)", ErrUnderflow},
+		{"log(0)", ErrDomain},
+		{"log2(0)", ErrDomain},
+		{"sqrt(-1)", ErrDomain},
+		{"0^-1", ErrDivisionByZero},
+		{"pow(0, -2)", ErrDivisionByZero},
+	}
+	for _, tt := range tests {
+		got, err := evalFloat(tt.expression)
+		calcErr, ok := err.(*CalcError)
+		if !ok || calcErr.Kind != tt.kind {
+			t.Errorf("%s = %q, %v; want a %s error", tt.expression, got, err, tt.kind)
+		}
+	}
+
+	// zeros that are really zero are fine
+	for _, expression := range []string{"0 * 1e-300", "0 / 5", "0^2", "exp(-1) * 0", "3 - 3", "floor(0.5)"} {
+		if got, err := evalFloat(expression); err != nil || got != "0" {
+			t.Errorf("%s = %q, %v; want 0", expression, got, err)
+		}
+	}
+}
+
+func TestCalcSessionModes(t *testing.T) {
+	tests := []struct {
+		mode       string
+		precision  int
+		expression string
+		want       string
+	}{
+		{modeExact, 0, "0.1 + 0.2", "3/10"},
+		{modeExact, 0, "2^100", "1267650600228229401496703205376"},
+		{modeExact, 5, "1/3", "1/3 ≈ 0.33333"},
+		{modeBig, 40, "1/3", "0.3333333333333333333333333333333333333333"},
+		{modeFloat, 4, "pi", "3.142"},
+	}
+	for _, tt := range tests {
+		got, err := NewCalcSession().Solve(tt.expression, tt.mode, tt.precision)
+		if want := "$1 = " + tt.want; err != nil || got != want {
+			t.Errorf("%s in %s mode = %q, %v; want %q", tt.expression, tt.mode, got, err, want)
+		}
+	}
+}
+
+func TestCalcErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		mode       string
+		kind       CalcErrorKind
+		pos        int
+	}{
+		{"2+banana", modeFloat, ErrUnknownToken, 3},
+		{"2 $ 3", modeFloat, ErrUnknownToken, 3},
+		{"(1", modeFloat, ErrUnbalancedParens, 1},
+		{"((1+2)", modeFloat, ErrUnbalancedParens, 1},
+		{"1)", modeFloat, ErrUnbalancedParens, 2},
+		{"1/0", modeFloat, ErrDivisionByZero, 2},
+		{"3 % 0", modeExact, ErrDivisionByZero, 3},
+		{"1e400", modeFloat, ErrOverflow, 1},
+		{"1 + 1e400", modeFloat, ErrOverflow, 5},
+		{"1 +", modeFloat, ErrSyntax, 4},
+		{"sqrt(1, 2)", modeFloat, ErrSyntax, 1},
+		{"2 * sqrt(-4)", modeFloat, ErrDomain, 5},
+		{"sin(1)", modeExact, ErrDomain, 1},
+	}
+	for _, tt := range tests {
+		_, err := NewCalcSession().Solve(tt.expression, tt.mode, 0)
+		calcErr, ok := err.(*CalcError)
+		if !ok {
+			t.Errorf("%s: got %v, want a *CalcError", tt.expression, err)
+			continue
+		}
+		if calcErr.Kind != tt.kind || calcErr.Pos != tt.pos {
+			t.Errorf("%s: got %s at position %d, want %s at position %d", tt.expression, calcErr.Kind, calcErr.Pos, tt.kind, tt.pos)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+//go:build bedrock
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+/* ------------------------------------------------------------------------
+   READ-ONLY SQL GUARD
+   ------------------------------------------------------------------------ */
+
+// defaultAllowedStatements are the statement kinds clickhouse_tool runs unless
+// ClickhouseClient.AllowedStatements says otherwise. WITH starts a SELECT with
+// common table expressions, DESC is short for DESCRIBE.
+var defaultAllowedStatements = []string{"SELECT", "WITH", "SHOW", "DESCRIBE", "DESC", "EXPLAIN"}
+
+// formatClausePattern matches a FORMAT clause, which ends a statement. A
+// function call like format('{}', x) or a column named format doesn't match.
+var formatClausePattern = regexp.MustCompile(`(?i)\bFORMAT\s+([A-Za-z0-9_]+)\s*$`)
+
+// guardQuery checks that the model's SQL is a single statement of an allowed
+// kind, and returns it without comments or the trailing semicolon, ready for a
+// FORMAT clause to be appended. The error text goes straight back to the
+// model, so it says what to change.
+func guardQuery(query string, allowed []string) (string, error) {
+	statements, err := splitStatements(query)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case len(statements) == 0:
+		return "", fmt.Errorf("the query is empty, send a single SELECT statement")
+	case len(statements) > 1:
+		return "", fmt.Errorf("only one statement per call is allowed, but the query has %d; "+
+			"remove the extra statements or make separate calls", len(statements))
+	}
+
+	statement := statements[0]
+	keyword := firstKeyword(statement)
+	permitted := false
+	for _, a := range allowed {
+		permitted = permitted || strings.EqualFold(keyword, a)
+	}
+	if !permitted {
+		return "", fmt.Errorf("%s statements are not allowed, the database is read-only; "+
+			"only %s queries can run, rewrite the query as one of those",
+			keyword, strings.Join(allowed, "/"))
+	}
+	// clickhouseTool appends FORMAT JSON, and a second FORMAT is a syntax error
+	if m := formatClausePattern.FindStringSubmatch(statement); m != nil {
+		return "", fmt.Errorf("remove the FORMAT %s clause, results always come back as JSON", m[1])
+	}
+	return statement, nil
+}
+
+// splitStatements splits SQL on semicolons that aren't inside string literals,
+// quoted identifiers or comments, strips the comments, and drops empty
+// statements. An unterminated quote or comment is an error, since where the
+// statement ends would be a guess.
+func splitStatements(query string) ([]string, error) {
+	var statements []string
+	start := 0
+	lex := sqlLexer{src: query}
+	for lex.pos < len(query) {
+		if lex.skipQuotedOrComment() {
+			if lex.unterminated != "" {
+				return nil, fmt.Errorf("the query has an unterminated %s, close it or remove it", lex.unterminated)
+			}
+			continue
+		}
+		if query[lex.pos] == ';' {
+			statements = appendStatement(statements, query[start:lex.pos])
+			start = lex.pos + 1
+		}
+		lex.pos++
+	}
+	return appendStatement(statements, query[start:]), nil
+}
+
+func appendStatement(statements []string, s string) []string {
+	s = strings.TrimSpace(stripComments(s))
+	if s == "" {
+		return statements
+	}
+	return append(statements, s)
+}
+
+// firstKeyword returns the first word of a statement, ignoring opening
+// parentheses, e.g. "(SELECT 1)" -> "SELECT"
+func firstKeyword(statement string) string {
+	s := strings.TrimLeft(statement, " \t\r\n(")
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '_'
+	})
+	if end == -1 {
+		end = len(s)
+	}
+	return strings.ToUpper(s[:end])
+}
+
+// stripComments removes -- and /* */ comments, keeping string literals intact
+func stripComments(s string) string {
+	var sb strings.Builder
+	lex := sqlLexer{src: s}
+	for lex.pos < len(s) {
+		start := lex.pos
+		if lex.skipQuotedOrComment() {
+			if s[start] != '-' && s[start] != '/' {
+				sb.WriteString(s[start:lex.pos])
+			} else {
+				sb.WriteByte(' ')
+			}
+			continue
+		}
+		sb.WriteByte(s[lex.pos])
+		lex.pos++
+	}
+	return sb.String()
+}
+
+// sqlLexer walks SQL text just far enough to know what's quoted or commented
+type sqlLexer struct {
+	src string
+	pos int
+
+	// unterminated names what skipQuotedOrComment ran off the end of, if anything
+	unterminated string
+}
+
+var quotedKinds = map[byte]string{'\'': "string literal", '"': "quoted identifier", '`': "quoted identifier"}
+
+// skipQuotedOrComment moves past a string literal, quoted identifier or
+// comment starting at pos, and reports whether it did
+func (l *sqlLexer) skipQuotedOrComment() bool {
+	s, i := l.src, l.pos
+	switch {
+	case s[i] == '\'' || s[i] == '"' || s[i] == '`':
+		quote := s[i]
+		i++
+		for i < len(s) {
+			if s[i] == '\\' {
+				i += 2
+				continue
+			}
+			if s[i] == quote {
+				// a doubled quote is an escaped quote
+				if i+1 < len(s) && s[i+1] == quote {
+					i += 2
+					continue
+				}
+				break
+			}
+			i++
+		}
+		if i >= len(s) {
+			l.unterminated = quotedKinds[quote]
+		}
+		l.pos = min(i+1, len(s))
+		return true
+
+	case strings.HasPrefix(s[i:], "--"):
+		if end := strings.IndexByte(s[i:], '\n'); end != -1 {
+			l.pos = i + end + 1
+		} else {
+			l.pos = len(s)
+		}
+		return true
+
+	case strings.HasPrefix(s[i:], "/*"):
+		if end := strings.Index(s[i+2:], "*/"); end != -1 {
+			l.pos = i + 2 + end + 2
+		} else {
+			l.pos = len(s)
+			l.unterminated = "/* comment"
+		}
+		return true
+	}
+	return false
+}
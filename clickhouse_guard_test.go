@@ -0,0 +1,72 @@
+//go:build bedrock
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGuardQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    string // the statement guardQuery returns
+		wantErr string // part of the error, "" if the query is allowed
+	}{
+		// allowed statements
+		{"SELECT 1", "SELECT 1", ""},
+		{"  select * from t;  ", "select * from t", ""},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", "WITH x AS (SELECT 1) SELECT * FROM x", ""},
+		{"(SELECT 1) UNION ALL (SELECT 2)", "(SELECT 1) UNION ALL (SELECT 2)", ""},
+		{"SHOW TABLES", "SHOW TABLES", ""},
+		{"DESC t", "DESC t", ""},
+		{"EXPLAIN SELECT 1", "EXPLAIN SELECT 1", ""},
+		{"SELECT format('{};', x) FROM t", "SELECT format('{};', x) FROM t", ""},
+		{"SELECT format FROM t", "SELECT format FROM t", ""},
+
+		// semicolons inside literals, identifiers and comments
+		{"SELECT ';' AS a", "SELECT ';' AS a", ""},
+		{`SELECT "a;b" FROM t`, `SELECT "a;b" FROM t`, ""},
+		{"SELECT `a;b` FROM t", "SELECT `a;b` FROM t", ""},
+		{`SELECT 'it\'s; fine'`, `SELECT 'it\'s; fine'`, ""},
+		{"SELECT 'it''s; fine'", "SELECT 'it''s; fine'", ""},
+		{"SELECT 1 -- ; DROP TABLE t", "SELECT 1", ""},
+		{"SELECT /* ; */ 1", "SELECT   1", ""},
+
+		// more than one statement
+		{"SELECT 1; DROP TABLE t", "", "only one statement"},
+		{"SELECT 1; SELECT 2;", "", "has 2"},
+		{"SELECT ';'; DROP TABLE t", "", "only one statement"},
+
+		// comments hiding other statement kinds
+		{"/* SELECT */ DROP TABLE t", "", "DROP statements are not allowed"},
+		{"-- SELECT\nDELETE FROM t WHERE 1", "", "DELETE statements are not allowed"},
+		{"INSERT INTO t VALUES (1)", "", "INSERT statements are not allowed"},
+		{"(DROP TABLE t)", "", "DROP statements are not allowed"},
+
+		// unterminated quotes and comments
+		{"SELECT 'abc; DROP TABLE t", "", "unterminated string literal"},
+		{`SELECT "abc`, "", "unterminated quoted identifier"},
+		{"SELECT `abc", "", "unterminated quoted identifier"},
+		{"SELECT 1 /* ; DROP TABLE t", "", "unterminated /* comment"},
+
+		// a FORMAT clause clashes with the FORMAT JSON we append
+		{"SELECT 1 FORMAT CSV", "", "remove the FORMAT CSV clause"},
+		{"select * from t format JSONEachRow;", "", "remove the FORMAT JSONEachRow clause"},
+
+		{"", "", "the query is empty"},
+		{" ; -- nothing\n", "", "the query is empty"},
+	}
+	for _, tt := range tests {
+		got, err := guardQuery(tt.query, defaultAllowedStatements)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("guardQuery(%q) = %q, %v; want an error containing %q", tt.query, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("guardQuery(%q) = %q, %v; want %q", tt.query, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+//go:build bedrock
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/* ------------------------------------------------------------------------
+   CLICKHOUSE QUERY PARAMETERS
+   ------------------------------------------------------------------------ */
+
+// The model writes placeholders like {city:String} in the query and passes
+// the values separately; they go to the server as param_city=... so values
+// are never spliced into the SQL text.
+
+// placeholderPattern matches a {name:Type} query parameter placeholder
+var placeholderPattern = regexp.MustCompile(`\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*:\s*([^{}]+?)\s*\}`)
+
+// paramNamePattern is what ClickHouse accepts as a parameter name
+var paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// queryParams checks the model's parameter values against the placeholders in
+// the query and encodes them for the HTTP interface. Errors say exactly which
+// placeholder or value is wrong, so the model can fix the call.
+func queryParams(query string, values map[string]interface{}) (map[string]string, error) {
+	placeholders := map[string]bool{}
+	for _, m := range placeholderPattern.FindAllStringSubmatch(query, -1) {
+		placeholders[m[1]] = true
+	}
+
+	var missing, unused []string
+	for name := range placeholders {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	for name := range values {
+		if !placeholders[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(unused)
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("the query uses placeholders %s but params has no value for them",
+			strings.Join(missing, ", "))
+	}
+	if len(unused) > 0 {
+		return nil, fmt.Errorf("params %s are not used in the query; reference each one as {name:Type}, e.g. {%s:String}",
+			strings.Join(unused, ", "), unused[0])
+	}
+
+	encoded := make(map[string]string, len(values))
+	for name, v := range values {
+		if !paramNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("param name '%s' is invalid, use letters, digits and underscores", name)
+		}
+		s, err := encodeParam(v)
+		if err != nil {
+			return nil, fmt.Errorf("param '%s': %v", name, err)
+		}
+		encoded[name] = s
+	}
+	return encoded, nil
+}
+
+// encodeParam renders a JSON value the way ClickHouse parses param_ values:
+// scalars as escaped text, arrays as literals like [1,2] or ['a','b']
+func encodeParam(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case nil:
+		return `\N`, nil
+	case string:
+		return paramEscaper.Replace(val), nil
+	case []interface{}:
+		items := make([]string, 0, len(val))
+		for _, item := range val {
+			s, err := paramLiteral(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return "[" + strings.Join(items, ",") + "]", nil
+	}
+	return paramLiteral(v)
+}
+
+// paramLiteral renders a value as a SQL literal, for use inside arrays
+func paramLiteral(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return quoteString(val), nil
+	case json.Number:
+		return val.String(), nil
+	case float64:
+		// past 2^53 a float64 can't say which integer was meant
+		if val == math.Trunc(val) && math.Abs(val) > 1<<53 {
+			return "", fmt.Errorf("%v is too large to pass exactly as a number, send it as a string", val)
+		}
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case []interface{}:
+		return encodeParam(val)
+	}
+	return "", fmt.Errorf("unsupported value %v (%s), use a string, number, boolean, null or array", v, jsonTypeOf(v))
+}
+
+// paramEscaper escapes text for ClickHouse's escaped (TSV-style) value format
+var paramEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// quoteString makes a ClickHouse string literal
+func quoteString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
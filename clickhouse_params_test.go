@@ -0,0 +1,72 @@
+//go:build bedrock
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQueryParams(t *testing.T) {
+	tests := []struct {
+		query   string
+		values  string // tool-call JSON, decoded like Bedrock's toolUse input
+		want    map[string]string
+		wantErr string
+	}{
+		{"SELECT * FROM t WHERE city = {city:String}", `{"city": "O'Hare\tIL"}`,
+			map[string]string{"city": `O'Hare\tIL`}, ""},
+		{"SELECT * FROM t WHERE id = {id:UInt64}", `{"id": 12345678901234567890}`,
+			map[string]string{"id": "12345678901234567890"}, ""},
+		{"SELECT {x:Float64}, {ok:Bool}, {n:Nullable(String)}", `{"x": 2.5, "ok": true, "n": null}`,
+			map[string]string{"x": "2.5", "ok": "true", "n": `\N`}, ""},
+		{"SELECT * FROM t WHERE id IN {ids:Array(UInt32)} OR name IN {names:Array(String)}", `{"ids": [1, 2], "names": ["a", "it's"]}`,
+			map[string]string{"ids": "[1,2]", "names": `['a','it\'s']`}, ""},
+		{"SELECT {a:String}, {b:String}", `{"a": "x"}`, nil, "no value for them"},
+		{"SELECT 1", `{"a": "x"}`, nil, "not used in the query"},
+		{"SELECT {m:String}", `{"m": {"k": 1}}`, nil, "unsupported value"},
+	}
+	for _, tt := range tests {
+		values, err := decodeJSONArgs([]byte(tt.values))
+		if err != nil {
+			t.Fatalf("%s: bad test values: %v", tt.values, err)
+		}
+		got, err := queryParams(tt.query, values)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("queryParams(%q, %s) error = %v, want one containing %q", tt.query, tt.values, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("queryParams(%q, %s) failed: %v", tt.query, tt.values, err)
+			continue
+		}
+		for name, want := range tt.want {
+			if got[name] != want {
+				t.Errorf("queryParams(%q, %s)[%s] = %q, want %q", tt.query, tt.values, name, got[name], want)
+			}
+		}
+	}
+}
+
+func TestParamLiteralRejectsInexactFloat(t *testing.T) {
+	if _, err := paramLiteral(float64(12345678901234567890)); err == nil || !strings.Contains(err.Error(), "send it as a string") {
+		t.Errorf("paramLiteral of a float64 past 2^53: error = %v, want one asking for a string", err)
+	}
+}
+
+func TestClickhouseArgsKeepLargeIntegers(t *testing.T) {
+	raw, err := decodeJSONArgs([]byte(`{"query": "SELECT {id:UInt64}", "params": {"id": 12345678901234567890}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var args clickhouseArgs
+	if err := decodeArgs(raw, &args); err != nil {
+		t.Fatal(err)
+	}
+	got, err := queryParams(args.Query, args.Params)
+	if err != nil || got["id"] != "12345678901234567890" {
+		t.Errorf("queryParams after decodeArgs = %v, %v; want id 12345678901234567890", got, err)
+	}
+}
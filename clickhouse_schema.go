@@ -0,0 +1,151 @@
+//go:build bedrock
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+/* ------------------------------------------------------------------------
+   CLICKHOUSE SCHEMA INTROSPECTION
+   ------------------------------------------------------------------------ */
+
+// maxSampleRows caps how many example rows clickhouse_describe_table returns
+const maxSampleRows = 10
+
+type listTablesArgs struct {
+	Database string `json:"database,omitempty" desc:"Database to list, defaults to the current database"`
+}
+
+type describeTableArgs struct {
+	Table      string `json:"table" desc:"Table name, optionally as database.table" minlen:"1"`
+	Database   string `json:"database,omitempty" desc:"Database the table is in, defaults to the current database"`
+	SampleRows int    `json:"sample_rows,omitempty" desc:"Number of example rows to include (default 3, max 10)"`
+}
+
+// ClickhouseSchema answers the model's questions about which databases,
+// tables and columns exist. Results are cached for the session, since the
+// model tends to ask for the same table several times while writing SQL.
+type ClickhouseSchema struct {
+	client *ClickhouseClient
+	cache  map[string]string
+}
+
+// NewClickhouseSchema returns an introspector with an empty cache
+func NewClickhouseSchema(client *ClickhouseClient) *ClickhouseSchema {
+	return &ClickhouseSchema{client: client, cache: map[string]string{}}
+}
+
+// register adds the introspection tools next to clickhouse_tool
+func (s *ClickhouseSchema) register(r *Registry) {
+	RegisterTyped(r, "clickhouse_list_databases", "Lists the ClickHouse databases. Use it before writing SQL instead of guessing names.",
+		func(args noArgs) (string, error) {
+			return s.cached("databases", s.listDatabases)
+		})
+
+	RegisterTyped(r, "clickhouse_list_tables", "Lists the tables in a ClickHouse database with their engine, row count and comment.",
+		func(args listTablesArgs) (string, error) {
+			return s.cached("tables:"+args.Database, func() (string, error) {
+				return s.listTables(args.Database)
+			})
+		})
+
+	RegisterTyped(r, "clickhouse_describe_table", "Describes a ClickHouse table: column names, types and comments, plus a few sample rows.",
+		func(args describeTableArgs) (string, error) {
+			database, table := args.Database, args.Table
+			if database == "" {
+				if db, name, ok := strings.Cut(table, "."); ok {
+					database, table = db, name
+				}
+			}
+			sampleRows := args.SampleRows
+			if sampleRows <= 0 {
+				sampleRows = 3
+			}
+			sampleRows = min(sampleRows, maxSampleRows)
+
+			key := fmt.Sprintf("describe:%s.%s:%d", database, table, sampleRows)
+			return s.cached(key, func() (string, error) {
+				return s.describeTable(database, table, sampleRows)
+			})
+		})
+}
+
+// cached returns the saved result for key, or runs fetch and saves it.
+// Errors aren't cached, so the model can retry after fixing a name.
+func (s *ClickhouseSchema) cached(key string, fetch func() (string, error)) (string, error) {
+	if result, ok := s.cache[key]; ok {
+		return result, nil
+	}
+	result, err := fetch()
+	if err != nil {
+		return "", err
+	}
+	s.cache[key] = result
+	return result, nil
+}
+
+func (s *ClickhouseSchema) listDatabases() (string, error) {
+	rows, err := s.client.rows("SELECT name, comment FROM system.databases ORDER BY name", nil)
+	if err != nil {
+		return "", err
+	}
+	return toJSON(rows)
+}
+
+func (s *ClickhouseSchema) listTables(database string) (string, error) {
+	rows, err := s.client.rows(
+		"SELECT database, name, engine, total_rows, comment FROM system.tables WHERE database = "+currentDatabaseOr+" ORDER BY name",
+		map[string]string{"database": database})
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", fmt.Errorf("no tables found in database '%s', check the name with clickhouse_list_databases", database)
+	}
+	return toJSON(rows)
+}
+
+func (s *ClickhouseSchema) describeTable(database, table string, sampleRows int) (string, error) {
+	params := map[string]string{"database": database, "table": table}
+	columns, err := s.client.rows(
+		"SELECT name, type, comment, is_in_primary_key FROM system.columns "+
+			"WHERE database = "+currentDatabaseOr+" AND table = {table:String} ORDER BY position",
+		params)
+	if err != nil {
+		return "", err
+	}
+	if len(columns) == 0 {
+		return "", fmt.Errorf("table '%s' not found, check the name with clickhouse_list_tables", table)
+	}
+
+	from := "{table:Identifier}"
+	if database != "" {
+		from = "{database:Identifier}." + from
+	}
+	samples, err := s.client.rows(fmt.Sprintf("SELECT * FROM %s LIMIT %d", from, sampleRows), params)
+	if err != nil {
+		return "", err
+	}
+
+	return toJSON(map[string]interface{}{
+		"database":    database,
+		"table":       table,
+		"columns":     columns,
+		"sample_rows": samples,
+	})
+}
+
+// currentDatabaseOr is the SQL for the {database:String} parameter, or the
+// current database if it's empty
+const currentDatabaseOr = "if({database:String} = '', currentDatabase(), {database:String})"
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error encoding JSON: %v", err)
+	}
+	return string(b), nil
+}
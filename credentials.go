@@ -0,0 +1,192 @@
+//go:build bedrock
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+/* ------------------------------------------------------------------------
+   CREDENTIALS
+   ------------------------------------------------------------------------ */
+
+// defaultSecretsFile is read if it exists. Set SECRETS_FILE to use another path.
+// It holds KEY=VALUE lines using the same names as the environment variables,
+// and must not be readable by group or others (chmod 600).
+const defaultSecretsFile = "secrets.env"
+
+// Settings is everything the Bedrock client needs that must not live in source.
+// Each value comes from the environment first, then the secrets file.
+type Settings struct {
+	AWSRegion       string // AWS_REGION, defaults to the AWS_REGION constant
+	AWSProfile      string // AWS_PROFILE, a profile in ~/.aws/config or ~/.aws/credentials
+	AWSAccessKey    string // AWS_ACCESS_KEY_ID
+	AWSSecretKey    string // AWS_SECRET_ACCESS_KEY
+	AWSSessionToken string // AWS_SESSION_TOKEN
+	ModelID         string // BEDROCK_MODEL_ID, defaults to the AWS_MODEL_ID constant
+
+	ClickhouseURL      string // CLICKHOUSE_URL
+	ClickhouseUser     string // CLICKHOUSE_USER
+	ClickhousePassword string // CLICKHOUSE_PASSWORD
+
+	// Result limits, 0 for none (see ClickhouseClient)
+	ClickhouseServerMaxRows  int // CLICKHOUSE_SERVER_MAX_ROWS, defaults to defaultServerMaxRows
+	ClickhouseServerMaxBytes int // CLICKHOUSE_SERVER_MAX_BYTES, defaults to defaultServerMaxBytes
+	ClickhouseMaxRows        int // CLICKHOUSE_MAX_ROWS, defaults to defaultMaxRows
+	ClickhouseMaxBytes       int // CLICKHOUSE_MAX_BYTES, defaults to defaultMaxBytes
+}
+
+// loadSettings resolves settings from the environment and the secrets file,
+// and fails with a list of what's missing
+func loadSettings() (*Settings, error) {
+	path := os.Getenv("SECRETS_FILE")
+	secrets, err := loadSecretsFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := func(name, fallback string) string {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+		if v := secrets[name]; v != "" {
+			return v
+		}
+		return fallback
+	}
+
+	var missing []string
+	lookupInt := func(name string, fallback int) int {
+		v := lookup(name, "")
+		if v == "" {
+			return fallback
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			missing = append(missing, name+" must be a whole number, 0 for no limit")
+		}
+		return n
+	}
+
+	s := &Settings{
+		AWSRegion:       lookup("AWS_REGION", AWS_REGION),
+		AWSProfile:      lookup("AWS_PROFILE", ""),
+		AWSAccessKey:    lookup("AWS_ACCESS_KEY_ID", ""),
+		AWSSecretKey:    lookup("AWS_SECRET_ACCESS_KEY", ""),
+		AWSSessionToken: lookup("AWS_SESSION_TOKEN", ""),
+		ModelID:         lookup("BEDROCK_MODEL_ID", AWS_MODEL_ID),
+
+		ClickhouseURL:      lookup("CLICKHOUSE_URL", ""),
+		ClickhouseUser:     lookup("CLICKHOUSE_USER", ""),
+		ClickhousePassword: lookup("CLICKHOUSE_PASSWORD", ""),
+
+		ClickhouseServerMaxRows:  lookupInt("CLICKHOUSE_SERVER_MAX_ROWS", defaultServerMaxRows),
+		ClickhouseServerMaxBytes: lookupInt("CLICKHOUSE_SERVER_MAX_BYTES", defaultServerMaxBytes),
+		ClickhouseMaxRows:        lookupInt("CLICKHOUSE_MAX_ROWS", defaultMaxRows),
+		ClickhouseMaxBytes:       lookupInt("CLICKHOUSE_MAX_BYTES", defaultMaxBytes),
+	}
+
+	if (s.AWSAccessKey == "") != (s.AWSSecretKey == "") {
+		missing = append(missing, "AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set together")
+	}
+	for _, setting := range []struct{ name, value string }{
+		{"CLICKHOUSE_URL", s.ClickhouseURL},
+		{"CLICKHOUSE_USER", s.ClickhouseUser},
+		{"CLICKHOUSE_PASSWORD", s.ClickhousePassword},
+	} {
+		if setting.value == "" {
+			missing = append(missing, setting.name+" is not set")
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing or invalid settings (set them in the environment or %s):\n  %s",
+			secretsFileName(path), strings.Join(missing, "\n  "))
+	}
+	return s, nil
+}
+
+// loadAWSConfig builds the AWS config. Static keys are used if given, otherwise
+// the standard chain (environment, shared config/credentials files, SSO, ...)
+// for the selected profile. Credentials are fetched once here so a bad setup
+// fails at startup instead of on the first message.
+func loadAWSConfig(s *Settings) (aws.Config, error) {
+	opts := []func(*config.LoadOptions) error{
+		config.WithRegion(s.AWSRegion),
+	}
+	if s.AWSProfile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(s.AWSProfile))
+	}
+	if s.AWSAccessKey != "" {
+		opts = append(opts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(s.AWSAccessKey, s.AWSSecretKey, s.AWSSessionToken)))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(), opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("loading AWS config: %v", err)
+	}
+	if _, err := cfg.Credentials.Retrieve(context.TODO()); err != nil {
+		return aws.Config{}, fmt.Errorf("no usable AWS credentials (set AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY, "+
+			"AWS_PROFILE, or add them to the secrets file): %v", err)
+	}
+	return cfg, nil
+}
+
+// loadSecretsFile reads KEY=VALUE lines from the secrets file. The default file
+// is optional, but one named by SECRETS_FILE has to exist.
+func loadSecretsFile(path string) (map[string]string, error) {
+	required := path != ""
+	path = secretsFileName(path)
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) && !required {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("secrets file: %v", err)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		return nil, fmt.Errorf("secrets file %s is readable by other users (mode %v), run: chmod 600 %s",
+			path, info.Mode().Perm(), path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("secrets file: %v", err)
+	}
+	defer f.Close()
+
+	secrets := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("secrets file %s line %d: expected KEY=VALUE", path, lineNo)
+		}
+		secrets[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"'`)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("secrets file: %v", err)
+	}
+	return secrets, nil
+}
+
+func secretsFileName(path string) string {
+	if path == "" {
+		return defaultSecretsFile
+	}
+	return path
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // IANA zones work even where the OS has no zoneinfo
+)
+
+/* ------------------------------------------------------------------------
+   DATE AND TIME ARITHMETIC
+   ------------------------------------------------------------------------ */
+
+type datetimeArgs struct {
+	Operation string `json:"operation" desc:"now: current time; convert: show a time in to_zone; add: add duration to time; diff: time from time to end" enum:"now,convert,add,diff"`
+	Time      string `json:"time,omitempty" desc:"ISO-8601 date/time like 2025-03-01T14:30, a time like 14:30 or 2:30pm (today), or now (default)"`
+	Zone      string `json:"zone,omitempty" desc:"IANA time zone like America/Chicago, an offset like UTC+2, or a place name; time and end are read in this zone. Default is the local zone"`
+	ToZone    string `json:"to_zone,omitempty" desc:"Zone to show the result in, same forms as zone. Default is zone"`
+	End       string `json:"end,omitempty" desc:"For diff: the second date/time, same forms as time"`
+	Duration  string `json:"duration,omitempty" desc:"For add: e.g. 90m, 2h30m, -3 days, 1 week 2 days, or ISO-8601 like P1DT2H"`
+}
+
+// registerTimeTools adds get_time and datetime, so the model never has to do
+// clock or calendar arithmetic itself. Place names are resolved to time
+// zones through geo.
+func registerTimeTools(r *Registry, geo Geocoder) {
+	RegisterTyped(r, "get_time", "Get the current date, time, weekday and UTC offset, locally or for a location or time zone",
+		func(args getTimeArgs) (string, error) {
+			return getTime(geo, args)
+		})
+
+	RegisterTyped(r, "datetime", "Date and time arithmetic with time zones: the current time anywhere, converting between zones, "+
+		"adding durations and the difference between two times. Results are ISO-8601.",
+		func(args datetimeArgs) (string, error) {
+			result, err := runDatetime(geo, args)
+			if err != nil {
+				return "", err
+			}
+			b, err := json.Marshal(result)
+			if err != nil {
+				return "", fmt.Errorf("encoding tool response: %v", err)
+			}
+			return string(b), nil
+		})
+}
+
+type getTimeArgs struct {
+	Location string `json:"location,omitempty" desc:"City or place to give the local time for"`
+	Timezone string `json:"timezone,omitempty" desc:"IANA time zone like Europe/London, or an offset like UTC-3"`
+}
+
+// getTime is the get_time tool: the current date and time in the given place
+// or zone, or the local zone if neither is given
+func getTime(geo Geocoder, args getTimeArgs) (string, error) {
+	if args.Location != "" && args.Timezone != "" {
+		return "", fmt.Errorf("give either location or timezone, not both")
+	}
+	zone := args.Timezone
+	if zone == "" {
+		zone = args.Location
+	}
+	loc, err := resolveZone(geo, zone)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(struct {
+		Location string `json:"location,omitempty"`
+		timeResult
+	}{args.Location, newTimeResult(time.Now().In(loc))})
+	if err != nil {
+		return "", fmt.Errorf("encoding tool response: %v", err)
+	}
+	return string(b), nil
+}
+
+func runDatetime(geo Geocoder, args datetimeArgs) (interface{}, error) {
+	loc, err := resolveZone(geo, args.Zone)
+	if err != nil {
+		return nil, err
+	}
+	outLoc := loc
+	if args.ToZone != "" {
+		if outLoc, err = resolveZone(geo, args.ToZone); err != nil {
+			return nil, err
+		}
+	}
+	t, err := parseTimeIn(args.Time, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch args.Operation {
+	case "now", "convert":
+		return newTimeResult(t.In(outLoc)), nil
+
+	case "add":
+		if args.Duration == "" {
+			return nil, fmt.Errorf("add needs a duration, e.g. 90m or 2 days")
+		}
+		d, err := parseCalendarDuration(args.Duration)
+		if err != nil {
+			return nil, err
+		}
+		return newTimeResult(d.addTo(t.In(outLoc))), nil
+
+	case "diff":
+		if args.End == "" {
+			return nil, fmt.Errorf("diff needs an end time to compare time with")
+		}
+		end, err := parseTimeIn(args.End, loc)
+		if err != nil {
+			return nil, err
+		}
+		return newDiffResult(t.In(outLoc), end.In(outLoc)), nil
+	}
+	return nil, fmt.Errorf("unknown operation '%s', use now, convert, add or diff", args.Operation)
+}
+
+// timeResult is how a point in time is shown to the model
+type timeResult struct {
+	ISO          string `json:"iso"`
+	Date         string `json:"date"`
+	Time         string `json:"time"`
+	Weekday      string `json:"weekday"`
+	Zone         string `json:"zone"`
+	Abbreviation string `json:"abbreviation"`
+	UTCOffset    string `json:"utc_offset"`
+}
+
+func newTimeResult(t time.Time) timeResult {
+	abbreviation, _ := t.Zone()
+	return timeResult{
+		ISO:          t.Format(time.RFC3339),
+		Date:         t.Format("2006-01-02"),
+		Time:         t.Format("15:04:05"),
+		Weekday:      t.Weekday().String(),
+		Zone:         t.Location().String(),
+		Abbreviation: abbreviation,
+		UTCOffset:    t.Format("-07:00"),
+	}
+}
+
+// diffResult is the time from one instant to another, negative if end is earlier
+type diffResult struct {
+	From         string  `json:"from"`
+	To           string  `json:"to"`
+	Duration     string  `json:"duration"` // ISO-8601, days are 24 hours
+	TotalSeconds float64 `json:"total_seconds"`
+	TotalMinutes float64 `json:"total_minutes"`
+	TotalHours   float64 `json:"total_hours"`
+	TotalDays    float64 `json:"total_days"`
+}
+
+func newDiffResult(from, to time.Time) diffResult {
+	d := to.Sub(from)
+	return diffResult{
+		From:         from.Format(time.RFC3339),
+		To:           to.Format(time.RFC3339),
+		Duration:     isoDuration(d),
+		TotalSeconds: d.Seconds(),
+		TotalMinutes: d.Minutes(),
+		TotalHours:   d.Hours(),
+		TotalDays:    d.Hours() / 24,
+	}
+}
+
+/* --- time zones --- */
+
+// fixedOffsetPattern matches zones given as an offset, e.g. UTC+2, GMT-05:00 or +0530
+var fixedOffsetPattern = regexp.MustCompile(`(?i)^(?:UTC|GMT)?\s*([+-])(\d{1,2})(?::?(\d{2}))?$`)
+
+// resolveZone turns an IANA name, a UTC offset or a place name into a
+// location. Place names go through geocodeLocation, which already returns
+// the place's IANA zone.
+func resolveZone(geo Geocoder, name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.EqualFold(name, "local") {
+		return time.Local, nil
+	}
+	if strings.EqualFold(name, "UTC") || strings.EqualFold(name, "GMT") || name == "Z" {
+		return time.UTC, nil
+	}
+	if m := fixedOffsetPattern.FindStringSubmatch(name); m != nil {
+		hours, _ := strconv.Atoi(m[2])
+		minutes := 0
+		if m[3] != "" {
+			minutes, _ = strconv.Atoi(m[3])
+		}
+		if hours > 14 || minutes > 59 {
+			return nil, fmt.Errorf("'%s' is not a valid UTC offset, offsets go from -12:00 to +14:00", name)
+		}
+		offset := hours*3600 + minutes*60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(fmt.Sprintf("UTC%s%02d:%02d", m[1], hours, minutes), offset), nil
+	}
+	if loc, err := time.LoadLocation(name); err == nil {
+		return loc, nil
+	}
+	if strings.Contains(name, "/") {
+		return nil, fmt.Errorf("unknown time zone '%s', use an IANA name like Europe/Paris", name)
+	}
+
+	_, _, tz, err := geocodeLocation(geo, name)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' is not a time zone, and looking it up as a place failed: %v", name, err)
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("the time zone '%s' for '%s' is unknown: %v", tz, name, err)
+	}
+	return loc, nil
+}
+
+/* --- parsing times --- */
+
+// Layouts tried in order; the ones with an offset ignore the zone argument
+var (
+	offsetLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05Z07:00", "2006-01-02T15:04Z07:00"}
+	dateLayouts   = []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+	clockLayouts  = []string{"15:04:05", "15:04", "3:04pm", "3:04 pm", "3pm", "3 pm"}
+)
+
+// parseTimeIn reads a date/time in the given zone, unless it carries its own offset
+func parseTimeIn(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	now := time.Now().In(loc)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	switch strings.ToLower(s) {
+	case "", "now":
+		return now, nil
+	case "today":
+		return midnight, nil
+	case "tomorrow":
+		return midnight.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), nil
+	}
+
+	for _, layout := range offsetLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range clockLayouts {
+		if t, err := time.Parse(layout, strings.ToLower(s)); err == nil {
+			return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("can't read the time '%s'; use ISO-8601 like 2025-03-01T14:30 or 2025-03-01T14:30:00+02:00, "+
+		"a time like 14:30 or 2:30pm, or now/today/tomorrow/yesterday", s)
+}
+
+/* --- durations --- */
+
+// calendarDuration is a duration whose years, months and days follow the
+// calendar (so adding a day across a DST change keeps the wall clock time)
+type calendarDuration struct {
+	years, months, days int
+	clock               time.Duration
+}
+
+// addTo adds years and months first, keeping the day within the month
+// (Jan 31 + 1 month is Feb 28, not Mar 3), then days, then the clock time
+func (d calendarDuration) addTo(t time.Time) time.Time {
+	if d.years != 0 || d.months != 0 {
+		firstOfMonth := time.Date(t.Year(), t.Month(), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+		target := firstOfMonth.AddDate(d.years, d.months, 0)
+		lastDay := target.AddDate(0, 1, -1).Day()
+		t = target.AddDate(0, 0, min(t.Day(), lastDay)-1)
+	}
+	return t.AddDate(0, 0, d.days).Add(d.clock)
+}
+
+var (
+	isoDurationPattern  = regexp.MustCompile(`^([+-])?P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+	durationPartPattern = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*([a-z]+)`)
+)
+
+// durationUnits maps the unit words the model may use to a canonical unit
+var durationUnits = map[string]string{
+	"y": "y", "yr": "y", "yrs": "y", "year": "y", "years": "y",
+	"mo": "mo", "month": "mo", "months": "mo",
+	"w": "w", "wk": "w", "wks": "w", "week": "w", "weeks": "w",
+	"d": "d", "day": "d", "days": "d",
+	"h": "h", "hr": "h", "hrs": "h", "hour": "h", "hours": "h",
+	"m": "m", "min": "m", "mins": "m", "minute": "m", "minutes": "m",
+	"s": "s", "sec": "s", "secs": "s", "second": "s", "seconds": "s",
+}
+
+// parseCalendarDuration reads ISO-8601 durations (P1Y2M3DT4H) and
+// human ones (1 week 2 days, -90m, 2h30m)
+func parseCalendarDuration(s string) (calendarDuration, error) {
+	s = strings.TrimSpace(s)
+	if m := isoDurationPattern.FindStringSubmatch(strings.ToUpper(s)); m != nil && strings.ContainsAny(s, "0123456789") {
+		atoi := func(v string) int { n, _ := strconv.Atoi(v); return n }
+		secs, _ := strconv.ParseFloat(m[8], 64)
+		d := calendarDuration{
+			years:  atoi(m[2]),
+			months: atoi(m[3]),
+			days:   atoi(m[4])*7 + atoi(m[5]),
+			clock:  time.Duration(atoi(m[6]))*time.Hour + time.Duration(atoi(m[7]))*time.Minute + time.Duration(secs*float64(time.Second)),
+		}
+		if m[1] == "-" {
+			d = d.negate()
+		}
+		return d, nil
+	}
+
+	text := strings.ToLower(s)
+	negative := strings.HasPrefix(text, "-")
+	text = strings.TrimLeft(text, "+- ")
+	var d calendarDuration
+	rest := durationPartPattern.ReplaceAllStringFunc(text, func(part string) string {
+		m := durationPartPattern.FindStringSubmatch(part)
+		value, _ := strconv.ParseFloat(m[1], 64)
+		unit, ok := durationUnits[m[2]]
+		switch {
+		case !ok:
+			return part // left over, reported below
+		case (unit == "y" || unit == "mo") && value != float64(int(value)):
+			return part
+		case unit == "y":
+			d.years += int(value)
+		case unit == "mo":
+			d.months += int(value)
+		case unit == "w" || unit == "d":
+			days := value
+			if unit == "w" {
+				days *= 7
+			}
+			d.days += int(days)
+			d.clock += time.Duration((days - float64(int(days))) * float64(24*time.Hour))
+		case unit == "h":
+			d.clock += time.Duration(value * float64(time.Hour))
+		case unit == "m":
+			d.clock += time.Duration(value * float64(time.Minute))
+		case unit == "s":
+			d.clock += time.Duration(value * float64(time.Second))
+		}
+		return ""
+	})
+	if strings.Trim(rest, " ,and") != "" || text == "" {
+		return calendarDuration{}, fmt.Errorf("can't read the duration '%s'; use e.g. 90m, 2h30m, -3 days, 1 week 2 days "+
+			"(years and months must be whole numbers) or ISO-8601 like P1DT2H", s)
+	}
+	if negative {
+		d = d.negate()
+	}
+	return d, nil
+}
+
+func (d calendarDuration) negate() calendarDuration {
+	return calendarDuration{-d.years, -d.months, -d.days, -d.clock}
+}
+
+// isoDuration formats a duration as ISO-8601, e.g. P1DT2H30M or -PT45M
+func isoDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+
+	var sb strings.Builder
+	sb.WriteString(sign + "P")
+	if days > 0 {
+		fmt.Fprintf(&sb, "%dD", days)
+	}
+	if hours > 0 || minutes > 0 || d > 0 || days == 0 {
+		sb.WriteString("T")
+		if hours > 0 {
+			fmt.Fprintf(&sb, "%dH", hours)
+		}
+		if minutes > 0 {
+			fmt.Fprintf(&sb, "%dM", minutes)
+		}
+		if d > 0 || (days == 0 && hours == 0 && minutes == 0) {
+			sb.WriteString(strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "S")
+		}
+	}
+	return sb.String()
+}
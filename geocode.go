@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+/* ------------------------------------------------------------------------
+   GEOCODING
+   ------------------------------------------------------------------------ */
+
+// Geocoder turns place names into coordinates and back. OpenMeteo is the
+// implementation; NewFixtureProvider makes one that works offline.
+type Geocoder interface {
+	// SearchPlaces returns up to count places matching name, best match
+	// first. countryCode (ISO-3166 alpha-2) narrows the search to one country.
+	// No match should be an error, but callers don't rely on it.
+	SearchPlaces(name string, count int, countryCode string) ([]GeoPlace, error)
+	// PlaceByID looks up a place by the id SearchPlaces returned
+	PlaceByID(id int64) (*GeoPlace, error)
+	// ReverseGeocode names the place at a coordinate
+	ReverseGeocode(lat, lon float64) (*ReversePlace, error)
+}
+
+// maxGeocodeCandidates caps how many places the geocode tool lists
+const maxGeocodeCandidates = 10
+
+// GeoPlace is one Open-Meteo geocoding result. ID is the GeoNames id, which
+// get_weather accepts as place_id once the model has picked a candidate.
+type GeoPlace struct {
+	ID          int64   `json:"id"`
+	Name        string  `json:"name"`
+	Admin1      string  `json:"admin1,omitempty"` // state, province, region
+	Admin2      string  `json:"admin2,omitempty"` // county, district
+	Country     string  `json:"country,omitempty"`
+	CountryCode string  `json:"country_code,omitempty"`
+	Population  int64   `json:"population,omitempty"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Elevation   float64 `json:"elevation,omitempty"`
+	Timezone    string  `json:"timezone,omitempty"`
+}
+
+// Label names the place with enough context to tell candidates apart,
+// e.g. "Springfield, Illinois, United States"
+func (p GeoPlace) Label() string {
+	parts := []string{p.Name}
+	for _, part := range []string{p.Admin1, p.Country} {
+		if part != "" && part != p.Name {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// geocodeLocation takes the best match for a place name
+func geocodeLocation(geo Geocoder, city string) (float64, float64, string, error) {
+	places, err := geo.SearchPlaces(city, 1, "")
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if len(places) == 0 {
+		return 0, 0, "", fmt.Errorf("no geocoding results for '%s'", city)
+	}
+	return places[0].Latitude, places[0].Longitude, places[0].Timezone, nil
+}
+
+// SearchPlaces uses Open-Meteo's geocoding search
+func (o *OpenMeteo) SearchPlaces(name string, count int, countryCode string) ([]GeoPlace, error) {
+	q := url.Values{}
+	q.Set("name", name)
+	q.Set("count", strconv.Itoa(count))
+	q.Set("language", "en")
+	q.Set("format", "json")
+	if countryCode != "" {
+		q.Set("countryCode", strings.ToUpper(countryCode))
+	}
+
+	var gr struct {
+		Results []GeoPlace `json:"results"`
+	}
+	if err := o.fetch(o.GeocodingURL+"/v1/search", q, &gr); err != nil {
+		return nil, err
+	}
+	if len(gr.Results) == 0 {
+		return nil, fmt.Errorf("no geocoding results for '%s'", name)
+	}
+	return gr.Results, nil
+}
+
+// PlaceByID uses Open-Meteo's geocoding get
+func (o *OpenMeteo) PlaceByID(id int64) (*GeoPlace, error) {
+	q := url.Values{}
+	q.Set("id", strconv.FormatInt(id, 10))
+	q.Set("language", "en")
+
+	var place GeoPlace
+	if err := o.fetch(o.GeocodingURL+"/v1/get", q, &place); err != nil {
+		return nil, fmt.Errorf("looking up place_id %d: %v", id, err)
+	}
+	if place.ID == 0 {
+		return nil, fmt.Errorf("no place with id %d, get ids from the geocode tool", id)
+	}
+	return &place, nil
+}
+
+// ReversePlace is what's at a coordinate, according to OpenStreetMap
+type ReversePlace struct {
+	DisplayName string  `json:"display_name"`
+	City        string  `json:"city,omitempty"`
+	State       string  `json:"state,omitempty"`
+	Country     string  `json:"country,omitempty"`
+	CountryCode string  `json:"country_code,omitempty"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+}
+
+// ReverseGeocode uses Nominatim, as Open-Meteo has no reverse lookup
+func (o *OpenMeteo) ReverseGeocode(lat, lon float64) (*ReversePlace, error) {
+	q := url.Values{}
+	q.Set("lat", strconv.FormatFloat(lat, 'f', 5, 64))
+	q.Set("lon", strconv.FormatFloat(lon, 'f', 5, 64))
+	q.Set("format", "jsonv2")
+	q.Set("zoom", "10") // city level
+	q.Set("accept-language", "en")
+
+	var nr struct {
+		DisplayName string `json:"display_name"`
+		Error       string `json:"error"`
+		Address     struct {
+			City        string `json:"city"`
+			Town        string `json:"town"`
+			Village     string `json:"village"`
+			State       string `json:"state"`
+			Country     string `json:"country"`
+			CountryCode string `json:"country_code"`
+		} `json:"address"`
+	}
+	if err := o.fetch(o.ReverseURL+"/reverse", q, &nr); err != nil {
+		return nil, err
+	}
+	if nr.Error != "" {
+		return nil, fmt.Errorf("nothing found at %.4f, %.4f: %s", lat, lon, nr.Error)
+	}
+
+	city := nr.Address.City
+	if city == "" {
+		city = nr.Address.Town
+	}
+	if city == "" {
+		city = nr.Address.Village
+	}
+	return &ReversePlace{
+		DisplayName: nr.DisplayName,
+		City:        city,
+		State:       nr.Address.State,
+		Country:     nr.Address.Country,
+		CountryCode: strings.ToUpper(nr.Address.CountryCode),
+		Latitude:    lat,
+		Longitude:   lon,
+	}, nil
+}
+
+/* --- geocode tool --- */
+
+type geocodeArgs struct {
+	Query       string   `json:"query,omitempty" desc:"Place name to look up, e.g. Springfield"`
+	CountryCode string   `json:"country_code,omitempty" desc:"Two-letter ISO country code to narrow the search, e.g. US" minlen:"2" maxlen:"2"`
+	Count       int      `json:"count,omitempty" desc:"Number of candidates, default 5, max 10"`
+	Latitude    *float64 `json:"latitude,omitempty" desc:"For reverse geocoding: latitude in degrees"`
+	Longitude   *float64 `json:"longitude,omitempty" desc:"For reverse geocoding: longitude in degrees"`
+}
+
+// geocodePlaces is the geocode tool: ranked candidates for a name, or the
+// place at a coordinate
+func geocodePlaces(geo Geocoder, args geocodeArgs) (string, error) {
+	var result interface{}
+	switch {
+	case args.Query != "" && (args.Latitude != nil || args.Longitude != nil):
+		return "", fmt.Errorf("give either query, or latitude and longitude, not both")
+
+	case args.Latitude != nil || args.Longitude != nil:
+		if args.Latitude == nil || args.Longitude == nil {
+			return "", fmt.Errorf("reverse geocoding needs both latitude and longitude")
+		}
+		if err := checkCoordinates(*args.Latitude, *args.Longitude); err != nil {
+			return "", err
+		}
+		place, err := geo.ReverseGeocode(*args.Latitude, *args.Longitude)
+		if err != nil {
+			return "", err
+		}
+		result = place
+
+	case args.Query != "":
+		count := args.Count
+		if count <= 0 {
+			count = 5
+		}
+		places, err := geo.SearchPlaces(args.Query, min(count, maxGeocodeCandidates), args.CountryCode)
+		if err != nil {
+			return "", err
+		}
+		type candidate struct {
+			Rank  int    `json:"rank"`
+			Label string `json:"label"`
+			GeoPlace
+		}
+		candidates := make([]candidate, len(places))
+		for i, p := range places {
+			candidates[i] = candidate{i + 1, p.Label(), p}
+		}
+		result = map[string]interface{}{
+			"candidates": candidates,
+			"hint":       "pass the chosen candidate's id to get_weather as place_id",
+		}
+
+	default:
+		return "", fmt.Errorf("give a query to search for, or latitude and longitude to reverse geocode")
+	}
+
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("encoding tool response: %v", err)
+	}
+	return string(b), nil
+}
+
+func checkCoordinates(lat, lon float64) error {
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return fmt.Errorf("coordinates %.4f, %.4f are out of range, latitude is -90..90 and longitude -180..180", lat, lon)
+	}
+	return nil
+}
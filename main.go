@@ -1,3 +1,5 @@
+//go:build !bedrock
+
 package main
 
 import (
@@ -10,9 +12,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"strconv"
 	"strings"
-	"time"
 )
 
 /*
@@ -39,6 +39,12 @@ hermes3:3b only one function call, barely ever works
 
 works:
 llama3.2:1b and 3b work but 3b is a LOT better
+
+running:
+go run .                 -> this Ollama client
+go run -tags bedrock .   -> the Bedrock client (basic_bedrock_toolcalling.go)
+WEATHER_FIXTURES=dir     -> weather and geocoding from saved JSON in dir, no network (see NewFixtureProvider)
+go test .                -> the weather tools against the fixtures in testdata/weather
 */
 // const model = "llama3.2:3b" //"smollm2:135m
 const model = "llama3.1:8b"
@@ -49,6 +55,9 @@ const model = "llama3.1:8b"
 
 // const model = "qwen2.5:0.5b"
 
+// stream prints the reply token by token instead of waiting for all of it
+const stream = true
+
 /* ------------------------------------------------------------------------
    OLLAMA-RELATED STRUCTS
    ------------------------------------------------------------------------ */
@@ -63,8 +72,9 @@ type OllamaRequest struct {
 
 // Message is a single role/content pair in the conversation
 type Message struct {
-	Role    string `json:"role"`    // "system", "user", "assistant", "tool", etc.
-	Content string `json:"content"` // The actual text
+	Role      string     `json:"role"`                 // "system", "user", "assistant", "tool", etc.
+	Content   string     `json:"content"`              // The actual text
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"` // tools the assistant called this turn
 }
 
 // Tool definition (following Ollama's official spec)
@@ -97,6 +107,8 @@ type OllamaResponse struct {
 		Content   string     `json:"content"`
 		ToolCalls []ToolCall `json:"tool_calls"`
 	} `json:"message"`
+	Done  bool   `json:"done"`  // last chunk of a streamed reply
+	Error string `json:"error"` // set if the stream fails midway
 }
 
 /* ------------------------------------------------------------------------
@@ -106,34 +118,33 @@ type OllamaResponse struct {
 func main() {
 	fmt.Println("Welcome to the Ollama CLI (function-calling). Type 'exit' to quit.")
 
-	// 1) Initialize conversation with a system message describing how to behave
-	messages := []Message{
+	provider := NewOllamaProvider(model)
+	provider.Stream = stream
+
+	// 1) Register the tools the model can call
+	backend := openMeteoFromEnv()
+	registry := newToolRegistry(backend, backend)
+
+	// 2) Initialize conversation with a system message describing how to behave
+	messages := []ChatMessage{
 		{
 			Role: "system",
 			Content: `You are a helpful AI assistant that talks like Samuel L. Jackson.
 You can call these functions if relevant:
-1. get_time() -> current system time
-2. calc(expression: string) -> evaluate a math expression
-3. wikipedia_titles(keyword: string) -> list Wikipedia page titles containing the keyword. Must only send one keyword! Example: wikipedia_titles("ducks") or wikipedia_titles("Florida")
-4. wikipedia_search(query: string) -> search Wikipedia for a short summary.  the query MUST be something obtained from "wikipedia_titles()"!
-5. get_weather(location: string) -> get a 7-day weather forecast
-
+` + registry.Describe() + `
 If asked for factual information, you can call the above functions to get the data.
 Example: If asked "What is the time now?", call get_time() and respond with the time.
 
 You MUST use the related tool every time a question would use information from it.
 
 If you are going to reference wikipedia data: 
-1. Call "wikipedia_titles" FIRST to get a list of page titles using a single word search.  This will list relevant article titles.
-2. IF you call "wikipedia_titles" you MUST then search "wikipedia_search" with relevant titles from the list.
-3. Call "wikipedia_search" with the exact title to get the summary.
-
-If you call "wikipedia_titles" with more than one word, you will also get an error, and a kitten dies.
-If you call "wikipedia_search" without calling "wikipedia_titles" first, you will get an error, and a kitten dies.
-If you call "wikipedia_search" with anthing not in the list returned by "wikipedia_titles", two kittens die.  
+1. Call "wikipedia_titles" FIRST with a single word to get a list of relevant article titles.
+2. Call "wikipedia_search" with one of those exact titles to get the summary.
+wikipedia_search rejects any title that an earlier wikipedia_titles call didn't return.
 
 
-if you must calculate time, convert the times to military time, then to minutes, and ignore seconds
+For anything involving dates, times, time zones or durations, call datetime instead of working it out yourself.
+calc remembers variables and results, so do multi-step math as separate calls, e.g. subtotal = 3*19.99, then subtotal*1.08
 
 You know NOTHING AT ALL that isn't returned by a tool.  If a tool gives you no answer, then say you can't answer the question.
 Important:
@@ -144,112 +155,6 @@ Important:
 		},
 	}
 
-	// 2) Define our tools to send to Ollama
-	tools := []Tool{
-		{
-			Type: "function",
-			Function: Function{
-				Name:        "get_time",
-				Description: "Get the current time as HH:MM:SS",
-				Parameters: map[string]interface{}{
-					"type":       "object",
-					"properties": map[string]interface{}{},
-				},
-			},
-		},
-		{
-			Type: "function",
-			Function: Function{
-				Name:        "calc",
-				Description: "Evaluate a math expression and return a numeric result",
-				Parameters: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"expression": map[string]interface{}{
-							"type":        "string",
-							"description": "A valid math expression, e.g. (2+2)*3",
-						},
-					},
-					"required": []string{"expression"},
-				},
-			},
-		},
-		{
-			Type: "function",
-			Function: Function{
-				Name:        "define_word",
-				Description: "Look up the definition of a given word in English.",
-				Parameters: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"word": map[string]interface{}{
-							"type":        "string",
-							"description": "The word to define",
-						},
-					},
-					"required": []string{"word"},
-				},
-			},
-		},
-		{
-			Type: "function",
-			Function: Function{
-				Name:        "wikipedia_search",
-				Description: "Search Wikipedia for a short summary of the given query.",
-				Parameters: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"query": map[string]interface{}{
-							"type":        "string",
-							"description": "Search topic (1 or 2 words only!)",
-						},
-					},
-					"required": []string{"query"},
-				},
-			},
-		},
-		{
-			Type: "function",
-			Function: Function{
-				Name:        "get_weather",
-				Description: "Returns a 7-day weather forecast for the specified location.",
-				Parameters: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"location": map[string]interface{}{
-							"type":        "string",
-							"description": "City or place to retrieve the forecast",
-						},
-					},
-					"required": []string{"location"},
-				},
-			},
-		},
-		// tool to do a one-off call to another LLM model hosted locally
-		{
-			Type: "function",
-			Function: Function{
-				Name:        "coder_llm",
-				Description: "Call another LLM model with a single message",
-				Parameters: map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"model": map[string]interface{}{
-							// use codellama:code
-							"type":        "string",
-							"description": "Model name to call",
-						},
-						"message": map[string]interface{}{
-							"type":        "string",
-							"description": "Message to send to the model",
-						},
-					},
-					"required": []string{"model", "message"},
-				},
-			},
-		},
-	}
-
 	// Start reading user input from console
 	scanner := bufio.NewScanner(os.Stdin)
 	for {
@@ -263,79 +168,92 @@ Important:
 		}
 
 		// Append user's message
-		messages = append(messages, Message{
+		messages = append(messages, ChatMessage{
 			Role:    "user",
 			Content: userInput,
 		})
 
-		// We'll allow up to N repeated "tool call" loops
-		const maxToolCalls = 5
-		toolCallCount := 0
-
-		// Repeatedly send messages to Ollama, handle tool calls, until we get normal text
-		for {
-			response, err := sendToOllama(messages, tools)
-			if err != nil {
-				fmt.Println("Error:", err)
-				break
-			}
+		// Let the model answer, calling tools as often as it needs to
+		messages = runAgentTurn(provider, messages, registry)
+	}
+	fmt.Println("Goodbye!")
+}
 
-			// Grab the assistant's content and possible tool calls
-			assistantContent := response.Message.Content
-			toolCalls := response.Message.ToolCalls
-
-			// If the model asked for no tools at all, it’s just giving us final text
-			if len(toolCalls) == 0 {
-				fmt.Println("Assistant:", assistantContent)
-				// Add the assistant's final text as a role=assistant message to conversation
-				messages = append(messages, Message{
-					Role:    "assistant",
-					Content: assistantContent,
-				})
-				break
-			}
+/* ------------------------------------------------------------------------
+   SENDING REQUESTS TO OLLAMA
+   ------------------------------------------------------------------------ */
 
-			// If we do have tool calls, handle them
-			if toolCallCount >= maxToolCalls {
-				fmt.Println("(Hit maximum tool calls – ignoring further requests.)")
-				// Print whatever content we got, and stop
-				fmt.Println("Assistant (partial):", assistantContent)
-				break
-			}
-			toolCallCount++
+// OllamaProvider is the Provider for a local Ollama server
+type OllamaProvider struct {
+	URL    string // /api/chat endpoint
+	Model  string
+	Stream bool // print tokens as they arrive
+}
 
-			for _, tc := range toolCalls {
-				fnName := tc.Function.Name
-				fnArgs := tc.Function.Arguments
+// NewOllamaProvider returns a provider for the default local Ollama endpoint
+func NewOllamaProvider(model string) *OllamaProvider {
+	return &OllamaProvider{
+		URL:   "http://localhost:11434/api/chat",
+		Model: model,
+	}
+}
 
-				fmt.Printf("[DEBUG] Model requested tool '%s' with args: %v\n", fnName, fnArgs)
-				toolResult := callTool(fnName, fnArgs)
+// Chat converts the neutral conversation to Ollama's format and sends it
+func (p *OllamaProvider) Chat(messages []ChatMessage, specs []ToolSpec) (*ChatResponse, error) {
+	ollamaMessages := make([]Message, 0, len(messages))
+	for _, m := range messages {
+		msg := Message{Role: m.Role, Content: m.Content}
+		for _, tc := range m.ToolCalls {
+			var call ToolCall
+			call.Function.Name = tc.Name
+			call.Function.Arguments = tc.Arguments
+			msg.ToolCalls = append(msg.ToolCalls, call)
+		}
+		// Ollama has no call ids, so name the tool in the result itself
+		if m.Role == "tool" {
+			msg.Content = fmt.Sprintf("Tool '%s' result: %s", m.ToolName, m.Content)
+		}
+		ollamaMessages = append(ollamaMessages, msg)
+	}
 
-				// Append a "tool" (or "function") role message to the conversation with the result
-				// so Ollama can see that tool’s output in the next step
-				messages = append(messages, Message{
-					Role:    "tool", // could also be "function"
-					Content: fmt.Sprintf("Tool '%s' result: %s", fnName, toolResult),
-				})
-			}
+	response, err := p.sendToOllama(ollamaMessages, ollamaTools(specs))
+	if err != nil {
+		return nil, err
+	}
 
-			// Now we loop again (send updated conversation so Ollama can continue)
-		}
+	result := &ChatResponse{Content: response.Message.Content, Streamed: p.Stream}
+	for _, tc := range response.Message.ToolCalls {
+		result.ToolCalls = append(result.ToolCalls, ChatToolCall{
+			Name:      tc.Function.Name,
+			Arguments: tc.Function.Arguments,
+		})
 	}
-	fmt.Println("Goodbye!")
+	return result, nil
 }
 
-/* ------------------------------------------------------------------------
-   SENDING REQUESTS TO OLLAMA
-   ------------------------------------------------------------------------ */
+// ollamaTools builds Ollama's tool list from the registry's specs
+func ollamaTools(specs []ToolSpec) []Tool {
+	var tools []Tool
+	for _, spec := range specs {
+		tools = append(tools, Tool{
+			Type: "function",
+			Function: Function{
+				Name:        spec.Name,
+				Description: spec.Description,
+				Parameters:  spec.Parameters,
+			},
+		})
+	}
+	return tools
+}
 
-func sendToOllama(messages []Message, tools []Tool) (*OllamaResponse, error) {
+func (p *OllamaProvider) sendToOllama(messages []Message, tools []Tool) (*OllamaResponse, error) {
 	// Build request
 	reqData := OllamaRequest{
-		Model:    model, //"llama3.2:1b", // Adjust to the local model you want to use
+		Model:    p.Model,
 		Messages: messages,
 		Tools:    tools,
-		Stream:   false, // set to false for full chunk, or true if you prefer streaming
+		Stream:   p.Stream, // false for one full chunk, true for NDJSON chunks as they're generated
 	}
 
 	// Convert to JSON
@@ -345,7 +263,7 @@ func sendToOllama(messages []Message, tools []Tool) (*OllamaResponse, error) {
 	}
 
 	// Post to Ollama /api/chat
-	resp, err := http.Post("http://localhost:11434/api/chat", "application/json", bytes.NewBuffer(jsonBytes))
+	resp, err := http.Post(p.URL, "application/json", bytes.NewBuffer(jsonBytes))
 	if err != nil {
 		return nil, fmt.Errorf("error POSTing to Ollama: %v", err)
 	}
@@ -356,6 +274,10 @@ func sendToOllama(messages []Message, tools []Tool) (*OllamaResponse, error) {
 		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, body)
 	}
 
+	if p.Stream {
+		return readOllamaStream(resp.Body)
+	}
+
 	// Parse response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -370,383 +292,229 @@ func sendToOllama(messages []Message, tools []Tool) (*OllamaResponse, error) {
 	return &result, nil
 }
 
-/* ------------------------------------------------------------------------
-   TOOL IMPLEMENTATIONS
-   ------------------------------------------------------------------------ */
+// readOllamaStream reads the NDJSON chunks of a streamed /api/chat reply,
+// printing content as it arrives, and folds them into one OllamaResponse.
+// Tool calls come in on the chunks near the end, so collect them from all of them.
+func readOllamaStream(body io.Reader) (*OllamaResponse, error) {
+	var result OllamaResponse
+	printing := false
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
 
-// callTool dispatches to the correct function based on name
-func callTool(name string, args map[string]interface{}) string {
-	var result string
-	switch name {
-	case "get_time":
-		result = time.Now().Format("15:04:05")
-
-	case "calc":
-		expr, _ := args["expression"].(string)
-		result = solveMathExpression(expr)
-
-	case "define_word":
-		word, _ := args["word"].(string)
-		// naive dictionary for demonstration
-		result = fmt.Sprintf("'%s': A sample definition. [Replace with real logic]", word)
-
-	case "wikipedia_titles":
-		// first, if given more than one word, return an error!
-		// if strings.Contains(args["keyword"].(string), " ") {
-		// 	result = "Error: Please provide only one word for Wikipedia search."
-		// 	break
-		// }
-		keyword, _ := args["keyword"].(string)
-		result = wikipediaListTitles(keyword)
-
-	case "wikipedia_search":
-		query, _ := args["query"].(string)
-		summary, err := wikipediaSearch(query)
-		if err != nil {
-			result = "Error searching Wikipedia: " + err.Error()
+		var chunk OllamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return nil, fmt.Errorf("JSON decode error: %v\nRaw: %s", err, string(line))
 		}
-		result = summary
-
-	case "get_weather":
-		location, _ := args["location"].(string)
-		result = getWeatherForecast(location)
-
-	case "coder_llm":
-		model, _ := args["model"].(string)
-		message, _ := args["message"].(string)
-		// Call another LLM model with a single message
-		// llmResult, err := callCoderLLM(model, message)
-		llmResult, err := callCoderLLM("codellama:code", message)
-		if err != nil {
-			result = fmt.Sprintf("Error calling model '%s': %v", model, err)
-		} else {
-			result = llmResult.Message.Content
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("Ollama error: %s", chunk.Error)
 		}
 
-	default:
-		result = "Unknown tool call"
-	}
-	// fmt.Printf("RESULT: %s\n", result)
-	// limit debug output
-	if len(result) > 100 {
-		fmt.Printf("Tool '%s' result: %s...\n", name, result[:100])
-	} else {
-		fmt.Printf("Tool '%s' result: %s\n", name, result)
-	}
-
-	return result
-}
-
-/* ------------------------------------------------------------------------
-   WIKIPEDIA SEARCH
-   ------------------------------------------------------------------------ */
+		if chunk.Message.Content != "" {
+			if !printing {
+				fmt.Print("Assistant: ")
+				printing = true
+			}
+			fmt.Print(chunk.Message.Content)
+		}
 
-func wikipediaSearch(query string) (string, error) {
-	endpoint := "https://en.wikipedia.org/w/api.php"
-	params := url.Values{}
-	params.Set("action", "query")
-	params.Set("prop", "extracts")
-	params.Set("exintro", "")
-	params.Set("explaintext", "")
-	params.Set("format", "json")
-	params.Set("redirects", "")
-	params.Set("titles", query)
+		result.Model = chunk.Model
+		result.CreatedAt = chunk.CreatedAt
+		if chunk.Message.Role != "" {
+			result.Message.Role = chunk.Message.Role
+		}
+		result.Message.Content += chunk.Message.Content
+		result.Message.ToolCalls = append(result.Message.ToolCalls, chunk.Message.ToolCalls...)
 
-	fullURL := endpoint + "?" + params.Encode()
-	resp, err := http.Get(fullURL)
-	if err != nil {
-		return "", fmt.Errorf("HTTP error: %v", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("Wikipedia API returned %d: %s", resp.StatusCode, body)
+		if chunk.Done {
+			result.Done = true
+			break
+		}
 	}
-
-	var wikiResp struct {
-		Query struct {
-			Pages map[string]struct {
-				Title   string `json:"title"`
-				Extract string `json:"extract"`
-			} `json:"pages"`
-		} `json:"query"`
+	if printing {
+		fmt.Println()
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&wikiResp); err != nil {
-		return "", err
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading stream: %v", err)
 	}
-
-	// Return the first page’s extract
-	for _, page := range wikiResp.Query.Pages {
-		if page.Extract == "" {
-			return fmt.Sprintf("No summary found for '%s'.", query), nil
-		}
-		return page.Extract, nil
+	if !result.Done {
+		return nil, fmt.Errorf("stream ended before the reply was done")
 	}
-	return fmt.Sprintf("No Wikipedia page found for '%s'.", query), nil
+	return &result, nil
 }
 
 /* ------------------------------------------------------------------------
-   SIMPLE MATH EVALUATION
+   TOOL IMPLEMENTATIONS
    ------------------------------------------------------------------------ */
 
-func solveMathExpression(expression string) string {
-	expression = strings.ReplaceAll(expression, " ", "")
-	return fmt.Sprintf("%.2f", evaluate(expression))
+type calcArgs struct {
+	Expression string `json:"expression" desc:"A math expression or assignment, e.g. (2+2)*3, sqrt(2)*pi, max(1, -3), total = 19.99*3 or ans/2" minlen:"1"`
+	Mode       string `json:"mode,omitempty" desc:"float (default), exact for exact fractions such as money math and large integers, or big for many significant digits" enum:"float,exact,big"`
+	Precision  int    `json:"precision,omitempty" desc:"Significant digits in the result, up to 100 (float mode gives at most 17). Default is full float64 precision for float, 30 digits for big"`
 }
 
-func evaluate(expression string) float64 {
-	// parentheses
-	for strings.Contains(expression, "(") {
-		start := strings.LastIndex(expression, "(")
-		end := strings.Index(expression[start:], ")") + start
-		if end == -1 {
-			break
-		}
-		inner := expression[start+1 : end]
-		result := evaluate(inner)
-		expression = expression[:start] + fmt.Sprintf("%.2f", result) + expression[end+1:]
-	}
-
-	tokens := splitByPlusMinus(expression)
-
-	var result float64
-	var currentIndex int
-	for i, token := range tokens {
-		if i == 0 {
-			result = evaluateTerm(token)
-			currentIndex += len(token)
-		} else {
-			opIndex := currentIndex
-			operator := expression[opIndex]
-			currentIndex += 1 + len(token)
-
-			if operator == '+' {
-				result += evaluateTerm(token)
-			} else if operator == '-' {
-				result -= evaluateTerm(token)
-			}
-		}
-	}
-	return result
+type defineWordArgs struct {
+	Word string `json:"word" desc:"The word to define" minlen:"1"`
 }
 
-func splitByPlusMinus(expr string) []string {
-	var tokens []string
-	var sb strings.Builder
-	for i, r := range expr {
-		if r == '+' || r == '-' {
-			// if i == 0, it's a leading sign
-			if i > 0 {
-				tokens = append(tokens, sb.String())
-				sb.Reset()
-			}
-			sb.WriteRune(r)
-		} else {
-			sb.WriteRune(r)
-		}
-	}
-	tokens = append(tokens, sb.String())
-	return tokens
+type wikipediaTitlesArgs struct {
+	Keyword string `json:"keyword" desc:"A single keyword to look for in page titles" minlen:"1" maxlen:"50"`
 }
 
-func evaluateTerm(term string) float64 {
-	factors := splitByMultDiv(term)
-	if len(factors) == 0 {
-		return 0
-	}
-
-	result := evaluateFactor(factors[0])
-	offset := len(factors[0])
-	for i := 1; i < len(factors); i++ {
-		op := term[offset]
-		offset++
-		offset += len(factors[i])
+type wikipediaSearchArgs struct {
+	Query string `json:"query" desc:"Exact page title from a wikipedia_titles result" minlen:"1"`
+}
 
-		if op == '*' {
-			result *= evaluateFactor(factors[i])
-		} else if op == '/' {
-			result /= evaluateFactor(factors[i])
-		}
-	}
-	return result
+type coderLLMArgs struct {
+	Model   string `json:"model" desc:"Model name to call"` // use codellama:code
+	Message string `json:"message" desc:"Message to send to the model" minlen:"1"`
 }
 
-func splitByMultDiv(term string) []string {
-	var tokens []string
-	var sb strings.Builder
-	for i, r := range term {
-		if r == '*' || r == '/' {
-			if i > 0 {
-				tokens = append(tokens, sb.String())
-				sb.Reset()
+// newToolRegistry registers every tool this client offers the model
+func newToolRegistry(weather WeatherProvider, geocoder Geocoder) *Registry {
+	r := NewRegistry()
+
+	registerTimeTools(r, geocoder)
+
+	calc := NewCalcSession()
+	RegisterTyped(r, "calc", "Evaluate a math expression and return a numeric result. Supports + - * / % ^, parentheses, pi, e and functions like sqrt, log, sin, abs, min and max. "+
+		"Variables last for the conversation: assign with x = 3*4, then use x; $1, $2, ... and ans are earlier results",
+		func(args calcArgs) (string, error) {
+			return calc.Solve(args.Expression, args.Mode, args.Precision)
+		})
+
+	RegisterTyped(r, "define_word", "Look up the definition of a given word in English.",
+		func(args defineWordArgs) (string, error) {
+			// naive dictionary for demonstration
+			return fmt.Sprintf("'%s': A sample definition. [Replace with real logic]", args.Word), nil
+		})
+
+	NewWikipediaSession().register(r)
+
+	NewWeatherTools(weather, geocoder).register(r)
+
+	// tool to do a one-off call to another LLM model hosted locally
+	RegisterTyped(r, "coder_llm", "Call another LLM model with a single message",
+		func(args coderLLMArgs) (string, error) {
+			// Call another LLM model with a single message
+			// llmResult, err := callCoderLLM(args.Model, args.Message)
+			llmResult, err := callCoderLLM("codellama:code", args.Message)
+			if err != nil {
+				return "", fmt.Errorf("calling model '%s': %v", args.Model, err)
 			}
-			sb.WriteRune(r)
-		} else {
-			sb.WriteRune(r)
-		}
-	}
-	tokens = append(tokens, sb.String())
-	return tokens
-}
+			return llmResult.Message.Content, nil
+		})
 
-func evaluateFactor(factor string) float64 {
-	val, err := strconv.ParseFloat(factor, 64)
-	if err != nil {
-		return 0
-	}
-	return val
+	return r
 }
 
 /* ------------------------------------------------------------------------
-   WEATHER LOOKUP (via Open-Meteo)
+   WIKIPEDIA SEARCH
    ------------------------------------------------------------------------ */
 
-func getWeatherForecast(location string) string {
-	if location == "" {
-		return "Location not specified."
-	}
-	// 1) geocode the location
-	lat, lon, tz, err := geocodeLocation(location)
-	if err != nil {
-		return fmt.Sprintf("Error geocoding location '%s': %v", location, err)
-	}
-
-	// 2) build the forecast query
-	baseURL := "https://api.open-meteo.com/v1/forecast"
-	params := url.Values{}
-	params.Set("latitude", fmt.Sprintf("%.4f", lat))
-	params.Set("longitude", fmt.Sprintf("%.4f", lon))
-	params.Set("daily", "weathercode,temperature_2m_max,temperature_2m_min,uv_index_max,precipitation_probability_max,wind_speed_10m_max")
-	params.Set("current_weather", "true")
-	params.Set("timezone", tz)
-	params.Set("temperature_unit", "fahrenheit")
-	params.Set("wind_speed_unit", "mph")
-	params.Set("precipitation_unit", "inch")
-	params.Set("forecast_days", "7")
-
-	data, err := fetchWeatherData(baseURL, params)
-	if err != nil {
-		return fmt.Sprintf("Error fetching forecast: %v", err)
-	}
-
-	// 3) format a short text for demonstration
-	if len(data.Daily.Time) == 0 {
-		return fmt.Sprintf("No daily forecast found for %s", location)
-	}
-
-	result := fmt.Sprintf("7-Day forecast for %s (timezone: %s):\n\n", location, tz)
-	for i, day := range data.Daily.Time {
-		code := data.Daily.WeatherCode[i]
-		desc := wmoWeatherCodes[code]
-		maxT := data.Daily.Temperature2mMax[i]
-		minT := data.Daily.Temperature2mMin[i]
-		result += fmt.Sprintf("%s: %s, %.1f°F / %.1f°F\n", day, desc, maxT, minT)
-	}
-	return result
+// WikipediaSession enforces the titles-then-search workflow: wikipedia_search
+// only accepts a title that an earlier wikipedia_titles call returned, so the
+// model looks up real pages instead of guessing at names.
+type WikipediaSession struct {
+	titles map[string]string // lowercased title -> title as Wikipedia has it
 }
 
-type OpenMeteoResponse struct {
-	Daily struct {
-		Time             []string  `json:"time"`
-		WeatherCode      []int     `json:"weathercode"`
-		Temperature2mMax []float64 `json:"temperature_2m_max"`
-		Temperature2mMin []float64 `json:"temperature_2m_min"`
-	} `json:"daily"`
+func NewWikipediaSession() *WikipediaSession {
+	return &WikipediaSession{titles: map[string]string{}}
 }
 
-var wmoWeatherCodes = map[int]string{
-	0:  "Clear sky",
-	1:  "Mainly clear",
-	2:  "Partly cloudy",
-	3:  "Overcast",
-	45: "Fog",
-	48: "Depositing rime fog",
-	51: "Light drizzle",
-	53: "Moderate drizzle",
-	55: "Dense drizzle",
-	56: "Light freezing drizzle",
-	57: "Dense freezing drizzle",
-	61: "Slight rain",
-	63: "Moderate rain",
-	65: "Heavy rain",
-	66: "Light freezing rain",
-	67: "Heavy freezing rain",
-	71: "Slight snowfall",
-	73: "Moderate snowfall",
-	75: "Heavy snowfall",
-	80: "Slight rain showers",
-	81: "Moderate rain showers",
-	82: "Violent rain showers",
-	85: "Slight snow showers",
-	86: "Heavy snow showers",
-	95: "Thunderstorm",
-	96: "Thunderstorm with hail",
-	99: "Severe thunderstorm with hail",
+func (w *WikipediaSession) register(r *Registry) {
+	RegisterTyped(r, "wikipedia_titles", `List Wikipedia page titles containing the keyword. Send one keyword only, e.g. "ducks" or "Florida"`,
+		func(args wikipediaTitlesArgs) (string, error) {
+			return w.listTitles(args.Keyword)
+		})
+
+	RegisterTyped(r, "wikipedia_search", "Get the summary of a Wikipedia page. The query must be an exact title returned by wikipedia_titles.",
+		func(args wikipediaSearchArgs) (string, error) {
+			return w.search(args.Query)
+		})
 }
 
-func fetchWeatherData(baseURL string, params url.Values) (*OpenMeteoResponse, error) {
-	url := baseURL + "?" + params.Encode()
-	resp, err := http.Get(url)
+// listTitles looks up titles for one keyword and remembers them for search
+func (w *WikipediaSession) listTitles(keyword string) (string, error) {
+	if words := strings.Fields(keyword); len(words) != 1 {
+		return "", fmt.Errorf("send a single keyword, not '%s'; pick the most distinctive word", keyword)
+	}
+	titles, err := wikipediaListTitles(keyword)
 	if err != nil {
-		return nil, fmt.Errorf("HTTP error: %v", err)
+		return "", err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	for _, title := range titles {
+		w.titles[strings.ToLower(title)] = title
 	}
-	var data OpenMeteoResponse
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return nil, fmt.Errorf("decode error: %v", err)
+	res, _ := json.MarshalIndent(titles, "", "  ")
+	return string(res), nil
+}
+
+// search summarizes a page, if wikipedia_titles has offered its title
+func (w *WikipediaSession) search(query string) (string, error) {
+	if len(w.titles) == 0 {
+		return "", fmt.Errorf("call wikipedia_titles first; wikipedia_search only takes a title from its list")
+	}
+	title, ok := w.titles[strings.ToLower(strings.TrimSpace(query))]
+	if !ok {
+		return "", fmt.Errorf("'%s' is not a title wikipedia_titles returned; use one of those exactly, "+
+			"or call wikipedia_titles with another keyword", query)
 	}
-	return &data, nil
+	return wikipediaSearch(title)
 }
 
-// geocodeLocation calls Open-Meteo's geocoding API
-func geocodeLocation(city string) (float64, float64, string, error) {
-	geoURL := "https://geocoding-api.open-meteo.com/v1/search"
-	q := url.Values{}
-	q.Set("name", city)
-	q.Set("count", "1")
-	q.Set("language", "en")
-	q.Set("format", "json")
+func wikipediaSearch(query string) (string, error) {
+	endpoint := "https://en.wikipedia.org/w/api.php"
+	params := url.Values{}
+	params.Set("action", "query")
+	params.Set("prop", "extracts")
+	params.Set("exintro", "")
+	params.Set("explaintext", "")
+	params.Set("format", "json")
+	params.Set("redirects", "")
+	params.Set("titles", query)
 
-	fullURL := fmt.Sprintf("%s?%s", geoURL, q.Encode())
+	fullURL := endpoint + "?" + params.Encode()
 	resp, err := http.Get(fullURL)
 	if err != nil {
-		return 0, 0, "", err
+		return "", fmt.Errorf("HTTP error: %v", err)
 	}
 	defer resp.Body.Close()
-
 	if resp.StatusCode != 200 {
 		body, _ := io.ReadAll(resp.Body)
-		return 0, 0, "", fmt.Errorf("status %d: %s", resp.StatusCode, body)
+		return "", fmt.Errorf("Wikipedia API returned %d: %s", resp.StatusCode, body)
 	}
 
-	type GeocodeResp struct {
-		Results []struct {
-			Latitude  float64 `json:"latitude"`
-			Longitude float64 `json:"longitude"`
-			Timezone  string  `json:"timezone"`
-		} `json:"results"`
+	var wikiResp struct {
+		Query struct {
+			Pages map[string]struct {
+				Title   string `json:"title"`
+				Extract string `json:"extract"`
+			} `json:"pages"`
+		} `json:"query"`
 	}
-	var gr GeocodeResp
-	if err := json.NewDecoder(resp.Body).Decode(&gr); err != nil {
-		return 0, 0, "", err
+	if err := json.NewDecoder(resp.Body).Decode(&wikiResp); err != nil {
+		return "", err
 	}
 
-	if len(gr.Results) == 0 {
-		return 0, 0, "", fmt.Errorf("no geocoding results for '%s'", city)
+	// Return the first page’s extract
+	for _, page := range wikiResp.Query.Pages {
+		if page.Extract == "" {
+			return fmt.Sprintf("No summary found for '%s'.", query), nil
+		}
+		return page.Extract, nil
 	}
-	return gr.Results[0].Latitude, gr.Results[0].Longitude, gr.Results[0].Timezone, nil
+	return fmt.Sprintf("No Wikipedia page found for '%s'.", query), nil
 }
 
 // wikipediaListTitles returns a list of Wikipedia page titles containing the given keyword.
-func wikipediaListTitles(keyword string) string {
-	if keyword == "" {
-		return "No query provided."
-	}
-
+func wikipediaListTitles(keyword string) ([]string, error) {
 	endpoint := "https://en.wikipedia.org/w/api.php"
 	vals := url.Values{}
 	vals.Set("action", "query")
@@ -761,13 +529,13 @@ func wikipediaListTitles(keyword string) string {
 	fullURL := fmt.Sprintf("%s?%s", endpoint, vals.Encode())
 	resp, err := http.Get(fullURL)
 	if err != nil {
-		return fmt.Sprintf("Error calling Wikipedia: %v", err)
+		return nil, fmt.Errorf("calling Wikipedia: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		b, _ := ioutil.ReadAll(resp.Body)
-		return fmt.Sprintf("Wikipedia API error %d: %s", resp.StatusCode, string(b))
+		return nil, fmt.Errorf("Wikipedia API error %d: %s", resp.StatusCode, string(b))
 	}
 
 	var data struct {
@@ -778,14 +546,11 @@ func wikipediaListTitles(keyword string) string {
 		} `json:"query"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return fmt.Sprintf("Error decoding Wikipedia JSON: %v", err)
+		return nil, fmt.Errorf("decoding Wikipedia JSON: %v", err)
 	}
 
 	if len(data.Query.Search) == 0 {
-		// For troubleshooting, let’s see the full raw JSON if no hits:
-		// (You can remove this if you want less verbosity.)
-		raw, _ := json.MarshalIndent(data, "", "  ")
-		return fmt.Sprintf("No page titles found for '%s'. Raw response:\n%s", keyword, string(raw))
+		return nil, fmt.Errorf("no page titles found for '%s', try a different keyword", keyword)
 	}
 
 	// Gather the titles
@@ -793,10 +558,7 @@ func wikipediaListTitles(keyword string) string {
 	for _, item := range data.Query.Search {
 		titles = append(titles, item.Title)
 	}
-
-	// Return them as JSON array or however you prefer
-	res, _ := json.MarshalIndent(titles, "", "  ")
-	return string(res)
+	return titles, nil
 }
 
 // callCoderLLM calls another LLM model with a single message
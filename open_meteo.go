@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+/* ------------------------------------------------------------------------
+   OPEN-METEO BACKEND
+   ------------------------------------------------------------------------ */
+
+// OpenMeteo is the default Geocoder and WeatherProvider. Each base URL can
+// point at a self-hosted Open-Meteo or a proxy. Reverse geocoding uses
+// Nominatim, since Open-Meteo has none.
+type OpenMeteo struct {
+	ForecastURL   string // /v1/forecast
+	ArchiveURL    string // /v1/archive
+	AirQualityURL string // /v1/air-quality
+	GeocodingURL  string // /v1/search and /v1/get
+	ReverseURL    string // Nominatim /reverse
+
+	// fetch GETs an endpoint and decodes the JSON into out. It is
+	// fetchHTTP, or fetchFixture for a fixture provider.
+	fetch func(endpoint string, params url.Values, out interface{}) error
+}
+
+// NewOpenMeteo returns a backend for the public Open-Meteo and Nominatim APIs
+func NewOpenMeteo() *OpenMeteo {
+	return &OpenMeteo{
+		ForecastURL:   "https://api.open-meteo.com",
+		ArchiveURL:    "https://archive-api.open-meteo.com",
+		AirQualityURL: "https://air-quality-api.open-meteo.com",
+		GeocodingURL:  "https://geocoding-api.open-meteo.com",
+		ReverseURL:    "https://nominatim.openstreetmap.org",
+		fetch:         fetchHTTP,
+	}
+}
+
+// NewFixtureProvider returns a backend that reads saved API responses from
+// dir instead of the network, so the whole weather path runs offline. A
+// request to .../v1/search?name=Paris reads search_paris.json if it exists,
+// otherwise search.json; likewise get_<id>.json, reverse.json,
+// forecast.json, archive.json and air-quality.json.
+func NewFixtureProvider(dir string) *OpenMeteo {
+	o := NewOpenMeteo()
+	o.fetch = func(endpoint string, params url.Values, out interface{}) error {
+		return fetchFixture(dir, endpoint, params, out)
+	}
+	return o
+}
+
+// openMeteoFromEnv builds the backend from the environment: WEATHER_FIXTURES
+// names a fixture directory, and OPEN_METEO_FORECAST_URL,
+// OPEN_METEO_ARCHIVE_URL, OPEN_METEO_AIR_QUALITY_URL,
+// OPEN_METEO_GEOCODING_URL and NOMINATIM_URL override the base URLs.
+func openMeteoFromEnv() *OpenMeteo {
+	o := NewOpenMeteo()
+	if dir := os.Getenv("WEATHER_FIXTURES"); dir != "" {
+		o = NewFixtureProvider(dir)
+	}
+	for name, field := range map[string]*string{
+		"OPEN_METEO_FORECAST_URL":    &o.ForecastURL,
+		"OPEN_METEO_ARCHIVE_URL":     &o.ArchiveURL,
+		"OPEN_METEO_AIR_QUALITY_URL": &o.AirQualityURL,
+		"OPEN_METEO_GEOCODING_URL":   &o.GeocodingURL,
+		"NOMINATIM_URL":              &o.ReverseURL,
+	} {
+		if v := os.Getenv(name); v != "" {
+			*field = strings.TrimRight(v, "/")
+		}
+	}
+	return o
+}
+
+// fetchHTTP fetches endpoint?params and decodes the JSON body into out
+func fetchHTTP(endpoint string, params url.Values, out interface{}) error {
+	req, err := http.NewRequest("GET", endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	// Nominatim turns away requests without one
+	req.Header.Set("User-Agent", "ollama-toolcalling-client")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode error: %v", err)
+	}
+	return nil
+}
+
+// fixtureSlugPattern is what fixture file names keep of a search term
+var fixtureSlugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// fetchFixture decodes the fixture file for a request into out
+func fetchFixture(dir, endpoint string, params url.Values, out interface{}) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	name := path.Base(u.Path)
+
+	candidates := []string{name + ".json"}
+	if key := params.Get("name") + params.Get("id"); key != "" {
+		slug := strings.Trim(fixtureSlugPattern.ReplaceAllString(strings.ToLower(key), "-"), "-")
+		candidates = append([]string{name + "_" + slug + ".json"}, candidates...)
+	}
+
+	for _, file := range candidates {
+		b, err := os.ReadFile(filepath.Join(dir, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("fixture: %v", err)
+		}
+		if err := json.Unmarshal(b, out); err != nil {
+			return fmt.Errorf("fixture %s: decode error: %v", file, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no fixture for %s in %s (tried %s)", endpoint, dir, strings.Join(candidates, ", "))
+}
@@ -0,0 +1,185 @@
+//go:build !bedrock
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+/* ------------------------------------------------------------------------
+   OPEN-METEO WEATHER PROVIDER
+   ------------------------------------------------------------------------ */
+
+// openMeteoUnits are Open-Meteo's temperature, wind speed and precipitation
+// unit parameters for each unit system
+var openMeteoUnits = map[string][3]string{
+	"imperial": {"fahrenheit", "mph", "inch"},
+	"metric":   {"celsius", "kmh", "mm"},
+}
+
+// Forecast uses Open-Meteo's forecast API
+func (o *OpenMeteo) Forecast(req WeatherRequest) (*WeatherData, error) {
+	params, err := o.weatherParams(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Hourly {
+		params.Set("hourly", "weathercode,temperature_2m,precipitation_probability,wind_speed_10m")
+	} else {
+		params.Set("daily", "weathercode,temperature_2m_max,temperature_2m_min,uv_index_max,precipitation_probability_max,wind_speed_10m_max")
+	}
+	params.Set("current_weather", "true")
+	return o.weatherData(o.ForecastURL+"/v1/forecast", params)
+}
+
+// History uses Open-Meteo's historical weather API
+func (o *OpenMeteo) History(req WeatherRequest) (*WeatherData, error) {
+	params, err := o.weatherParams(req)
+	if err != nil {
+		return nil, err
+	}
+	params.Set("daily", "temperature_2m_max,temperature_2m_min,temperature_2m_mean,precipitation_sum,wind_speed_10m_max")
+	return o.weatherData(o.ArchiveURL+"/v1/archive", params)
+}
+
+// AirQuality uses Open-Meteo's air quality API
+func (o *OpenMeteo) AirQuality(req WeatherRequest) (*AirQualityData, error) {
+	params := o.placeParams(req)
+	params.Set("current", "us_aqi,pm2_5")
+	params.Set("hourly", "us_aqi,pm2_5,pm10,ozone")
+
+	var resp openMeteoAirQuality
+	if err := o.fetch(o.AirQualityURL+"/v1/air-quality", params, &resp); err != nil {
+		return nil, err
+	}
+	data := &AirQualityData{
+		Timezone: resp.Timezone,
+		Hourly:   HourlyAirQuality(resp.Hourly),
+	}
+	if c := resp.Current; c != nil {
+		data.Current = &AirQualityReading{Time: c.Time, USAQI: c.USAQI, PM2_5: c.PM2_5}
+	}
+	return data, nil
+}
+
+// placeParams are the query parameters every Open-Meteo API takes: where,
+// the time zone and which days
+func (o *OpenMeteo) placeParams(req WeatherRequest) url.Values {
+	params := url.Values{}
+	params.Set("latitude", fmt.Sprintf("%.4f", req.Latitude))
+	params.Set("longitude", fmt.Sprintf("%.4f", req.Longitude))
+	tz := req.Timezone
+	if tz == "" {
+		tz = "auto" // Open-Meteo picks the zone from the coordinates
+	}
+	params.Set("timezone", tz)
+	if req.StartDate != "" {
+		params.Set("start_date", req.StartDate)
+		params.Set("end_date", req.EndDate)
+	} else if req.Days > 0 {
+		params.Set("forecast_days", strconv.Itoa(req.Days))
+	}
+	return params
+}
+
+// weatherParams adds the unit parameters for the forecast and archive APIs
+func (o *OpenMeteo) weatherParams(req WeatherRequest) (url.Values, error) {
+	units, ok := openMeteoUnits[req.Units]
+	if !ok {
+		return nil, fmt.Errorf("unknown units '%s', use metric or imperial", req.Units)
+	}
+	params := o.placeParams(req)
+	params.Set("temperature_unit", units[0])
+	params.Set("wind_speed_unit", units[1])
+	params.Set("precipitation_unit", units[2])
+	return params, nil
+}
+
+func (o *OpenMeteo) weatherData(endpoint string, params url.Values) (*WeatherData, error) {
+	var resp openMeteoWeather
+	if err := o.fetch(endpoint, params, &resp); err != nil {
+		return nil, err
+	}
+	data := &WeatherData{
+		Timezone: resp.Timezone,
+		Daily: DailyWeather{
+			Time:                        resp.Daily.Time,
+			WeatherCode:                 resp.Daily.WeatherCode,
+			TemperatureMax:              resp.Daily.Temperature2mMax,
+			TemperatureMin:              resp.Daily.Temperature2mMin,
+			TemperatureMean:             resp.Daily.Temperature2mMean,
+			PrecipitationSum:            resp.Daily.PrecipitationSum,
+			PrecipitationProbabilityMax: resp.Daily.PrecipitationProbabilityMax,
+			UVIndexMax:                  resp.Daily.UVIndexMax,
+			WindSpeedMax:                resp.Daily.WindSpeed10mMax,
+		},
+		Hourly: HourlyWeather{
+			Time:                     resp.Hourly.Time,
+			WeatherCode:              resp.Hourly.WeatherCode,
+			Temperature:              resp.Hourly.Temperature2m,
+			PrecipitationProbability: resp.Hourly.PrecipitationProbability,
+			WindSpeed:                resp.Hourly.WindSpeed10m,
+		},
+	}
+	if cw := resp.CurrentWeather; cw != nil {
+		data.Current = &CurrentWeather{
+			Time:          cw.Time,
+			WeatherCode:   cw.WeatherCode,
+			Temperature:   cw.Temperature,
+			WindSpeed:     cw.WindSpeed,
+			WindDirection: cw.WindDirection,
+		}
+	}
+	return data, nil
+}
+
+// openMeteoWeather is the forecast and archive APIs' JSON
+type openMeteoWeather struct {
+	Timezone       string `json:"timezone"`
+	CurrentWeather *struct {
+		Time          string  `json:"time"`
+		Temperature   float64 `json:"temperature"`
+		WindSpeed     float64 `json:"windspeed"`
+		WindDirection float64 `json:"winddirection"`
+		WeatherCode   *int    `json:"weathercode"`
+	} `json:"current_weather"`
+	Daily struct {
+		Time        []string `json:"time"`
+		WeatherCode []*int   `json:"weathercode"`
+		// Open-Meteo sends null where it has no value, e.g. precipitation
+		// probability late in the forecast, or archive days not yet processed
+		Temperature2mMax            []*float64 `json:"temperature_2m_max"`
+		Temperature2mMin            []*float64 `json:"temperature_2m_min"`
+		Temperature2mMean           []*float64 `json:"temperature_2m_mean"` // archive only
+		PrecipitationSum            []*float64 `json:"precipitation_sum"`   // archive only
+		UVIndexMax                  []*float64 `json:"uv_index_max"`
+		PrecipitationProbabilityMax []*float64 `json:"precipitation_probability_max"`
+		WindSpeed10mMax             []*float64 `json:"wind_speed_10m_max"`
+	} `json:"daily"`
+	Hourly struct {
+		Time                     []string   `json:"time"`
+		WeatherCode              []*int     `json:"weathercode"`
+		Temperature2m            []*float64 `json:"temperature_2m"`
+		PrecipitationProbability []*float64 `json:"precipitation_probability"`
+		WindSpeed10m             []*float64 `json:"wind_speed_10m"`
+	} `json:"hourly"`
+}
+
+// openMeteoAirQuality is the air quality API's JSON
+type openMeteoAirQuality struct {
+	Timezone string `json:"timezone"`
+	Current  *struct {
+		Time  string   `json:"time"`
+		USAQI *float64 `json:"us_aqi"`
+		PM2_5 *float64 `json:"pm2_5"`
+	} `json:"current"`
+	Hourly struct {
+		Time  []string   `json:"time"`
+		USAQI []*float64 `json:"us_aqi"`
+		PM2_5 []*float64 `json:"pm2_5"`
+		PM10  []*float64 `json:"pm10"`
+		Ozone []*float64 `json:"ozone"`
+	} `json:"hourly"`
+}
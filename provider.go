@@ -0,0 +1,118 @@
+package main
+
+import "fmt"
+
+/* ------------------------------------------------------------------------
+   PROVIDER-NEUTRAL CHAT TYPES
+   ------------------------------------------------------------------------ */
+
+// ChatMessage is a single turn in the conversation, independent of backend
+type ChatMessage struct {
+	Role    string // "system", "user", "assistant" or "tool"
+	Content string
+
+	ToolCalls []ChatToolCall // assistant: the tool calls the model made this turn
+
+	ToolCallID string // tool: id of the call this result answers
+	ToolName   string // tool: name of the tool that ran
+	IsError    bool   // tool: the call failed and Content explains why
+}
+
+// ToolSpec describes a tool the model is allowed to call
+type ToolSpec struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{} // JSON schema for the arguments
+}
+
+// ChatToolCall is a single tool invocation requested by the model
+type ChatToolCall struct {
+	ID        string // backend call id (Bedrock toolUseId), empty for Ollama
+	Name      string
+	Arguments map[string]interface{}
+}
+
+// ChatResponse is the model's reply: plain text, tool calls, or both
+type ChatResponse struct {
+	Content   string
+	ToolCalls []ChatToolCall
+	Streamed  bool // Content was already printed while it streamed in
+}
+
+// Provider is a chat backend (Ollama, Bedrock, ...) that takes the
+// conversation plus the available tools and returns the model's reply
+type Provider interface {
+	Chat(messages []ChatMessage, tools []ToolSpec) (*ChatResponse, error)
+}
+
+/* ------------------------------------------------------------------------
+   AGENT LOOP
+   ------------------------------------------------------------------------ */
+
+// maxToolCalls caps how many rounds of tool calls we allow per user turn
+const maxToolCalls = 5
+
+// runAgentTurn repeatedly sends the conversation to the provider and runs the
+// tools it asks for, until the model answers with normal text.
+// It returns the conversation with the tool results and final answer appended.
+func runAgentTurn(provider Provider, messages []ChatMessage, registry *Registry) []ChatMessage {
+	tools := registry.Specs()
+	toolCallCount := 0
+
+	for {
+		response, err := provider.Chat(messages, tools)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return messages
+		}
+
+		// If the model asked for no tools at all, it’s just giving us final text
+		if len(response.ToolCalls) == 0 {
+			if response.Content == "" {
+				fmt.Println("Assistant: (No text response received)")
+			} else if !response.Streamed {
+				fmt.Println("Assistant:", response.Content)
+			}
+			return append(messages, ChatMessage{
+				Role:    "assistant",
+				Content: response.Content,
+			})
+		}
+
+		// If we do have tool calls, handle them
+		if toolCallCount >= maxToolCalls {
+			fmt.Println("(Hit maximum tool calls – ignoring further requests.)")
+			// Print whatever content we got, and stop
+			if !response.Streamed {
+				fmt.Println("Assistant (partial):", response.Content)
+			}
+			return messages
+		}
+		toolCallCount++
+
+		// Keep the model's own tool-call turn in the history, so each result
+		// below can be tied back to the call that asked for it
+		messages = append(messages, ChatMessage{
+			Role:      "assistant",
+			Content:   response.Content,
+			ToolCalls: response.ToolCalls,
+		})
+
+		for _, tc := range response.ToolCalls {
+			fmt.Printf("[DEBUG] Model requested tool '%s' with args: %v\n", tc.Name, tc.Arguments)
+			toolResult, failed := registry.Call(tc.Name, tc.Arguments)
+
+			// Append a "tool" role message with the result so the model can
+			// see that tool’s output in the next step
+			messages = append(messages, ChatMessage{
+				Role:       "tool",
+				Content:    toolResult,
+				ToolCallID: tc.ID,
+				ToolName:   tc.Name,
+				IsError:    failed,
+			})
+		}
+
+		// Now we loop again (send updated conversation so the model can continue)
+	}
+}
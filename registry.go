@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/* ------------------------------------------------------------------------
+   TOOL REGISTRY
+   ------------------------------------------------------------------------ */
+
+// ToolHandler runs a tool with the arguments the model sent
+type ToolHandler func(args map[string]interface{}) (string, error)
+
+// RegisteredTool is a tool's spec plus the Go function that implements it
+type RegisteredTool struct {
+	Spec    ToolSpec
+	Handler ToolHandler
+}
+
+// Registry holds every tool the model may call, in registration order
+type Registry struct {
+	tools map[string]*RegisteredTool
+	order []string
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{tools: map[string]*RegisteredTool{}}
+}
+
+// Register adds a tool. Registering the same name twice is a programming
+// error, so it panics.
+func (r *Registry) Register(name, description string, parameters map[string]interface{}, handler ToolHandler) {
+	if _, exists := r.tools[name]; exists {
+		panic(fmt.Sprintf("tool '%s' registered twice", name))
+	}
+	r.tools[name] = &RegisteredTool{
+		Spec: ToolSpec{
+			Name:        name,
+			Description: description,
+			Parameters:  parameters,
+		},
+		Handler: handler,
+	}
+	r.order = append(r.order, name)
+}
+
+// Specs returns the tool list to hand to a Provider
+func (r *Registry) Specs() []ToolSpec {
+	specs := make([]ToolSpec, 0, len(r.order))
+	for _, name := range r.order {
+		specs = append(specs, r.tools[name].Spec)
+	}
+	return specs
+}
+
+// Describe renders the tools as a numbered list for the system prompt, e.g.
+// 2. calc(expression: string) -> Evaluate a math expression
+func (r *Registry) Describe() string {
+	var sb strings.Builder
+	for i, name := range r.order {
+		spec := r.tools[name].Spec
+		fmt.Fprintf(&sb, "%d. %s(%s) -> %s\n", i+1, name, describeParams(spec.Parameters), spec.Description)
+	}
+	return sb.String()
+}
+
+// describeParams turns a JSON schema's properties into "name: type, ...",
+// marking the ones not in required with a ?, e.g. "zone?: string"
+func describeParams(schema map[string]interface{}) string {
+	props, _ := schema["properties"].(map[string]interface{})
+	required := map[string]bool{}
+	for _, name := range schemaStrings(schema["required"]) {
+		required[name] = true
+	}
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		typ := "any"
+		if prop, ok := props[name].(map[string]interface{}); ok {
+			if t, ok := prop["type"].(string); ok {
+				typ = t
+			}
+		}
+		if !required[name] {
+			name += "?"
+		}
+		parts = append(parts, name+": "+typ)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// safeCall runs a handler, turning a panic into an error so one bad tool call
+// fails that call instead of ending the session
+func safeCall(handler ToolHandler, args map[string]interface{}) (out string, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			out, err = "", fmt.Errorf("the tool crashed: %v", p)
+		}
+	}()
+	return handler(args)
+}
+
+// Call dispatches a tool call by name and returns the text to give the model,
+// and whether the call failed. Arguments are checked against the tool's schema
+// first, and both validation and handler errors are reported back as text so
+// the model can react to them.
+func (r *Registry) Call(name string, args map[string]interface{}) (result string, failed bool) {
+	tool, ok := r.tools[name]
+	if !ok {
+		result, failed = fmt.Sprintf("Unknown tool '%s'", name), true
+	} else if problems := validateArgs(tool.Spec.Parameters, args); len(problems) > 0 {
+		result, failed = argumentError(name, problems), true
+	} else if out, err := safeCall(tool.Handler, args); err != nil {
+		result, failed = fmt.Sprintf("Error: %v", err), true
+	} else {
+		result = out
+	}
+
+	// limit debug output
+	if len(result) > 100 {
+		fmt.Printf("Tool '%s' result: %s...\n", name, result[:100])
+	} else {
+		fmt.Printf("Tool '%s' result: %s\n", name, result)
+	}
+	return result, failed
+}
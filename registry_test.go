@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestDescribeMarksOptionalParams(t *testing.T) {
+	r := NewRegistry()
+	RegisterTyped(r, "convert", "Convert a time", func(args struct {
+		Time string `json:"time"`
+		Zone string `json:"zone,omitempty"`
+	}) (string, error) {
+		return "", nil
+	})
+	RegisterTyped(r, "ping", "Check the connection", func(args struct{}) (string, error) {
+		return "", nil
+	})
+
+	want := "1. convert(time: string, zone?: string) -> Convert a time\n" +
+		"2. ping() -> Check the connection\n"
+	if got := r.Describe(); got != want {
+		t.Errorf("Describe() = %q, want %q", got, want)
+	}
+}
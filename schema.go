@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/* ------------------------------------------------------------------------
+   TYPED TOOL ARGUMENTS
+   ------------------------------------------------------------------------ */
+
+// Tool arguments are declared as a Go struct, e.g.
+//
+//	type weatherArgs struct {
+//		Location string `json:"location" desc:"City or place to retrieve the forecast"`
+//		Units    string `json:"units,omitempty" desc:"Unit system" enum:"metric,imperial"`
+//	}
+//
+// The json tag names the property, and a field is required unless its json
+// tag has omitempty. desc becomes the property description, enum a comma
+// separated list of allowed values, and minlen/maxlen bound string length.
+// Embedded structs have their fields flattened in, as encoding/json does,
+// so tools can share a group of arguments.
+
+// noArgs is the argument struct for tools that take no parameters
+type noArgs struct{}
+
+// RegisterTyped registers a tool whose parameters schema is generated from
+// the argument struct A, and whose handler gets the arguments decoded into A
+func RegisterTyped[A any](r *Registry, name, description string, handler func(args A) (string, error)) {
+	r.Register(name, description, schemaFor(reflect.TypeOf((*A)(nil)).Elem()),
+		func(raw map[string]interface{}) (string, error) {
+			var args A
+			if err := decodeArgs(raw, &args); err != nil {
+				return "", err
+			}
+			return handler(args)
+		})
+}
+
+// decodeArgs copies the model's raw arguments into a typed struct by way of
+// JSON. Numbers in interface{} fields stay json.Number, so large integers
+// aren't rounded through float64.
+func decodeArgs(raw map[string]interface{}, out interface{}) error {
+	if raw == nil {
+		raw = map[string]interface{}{}
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(out); err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+	return nil
+}
+
+// schemaFor builds the JSON schema for a Go type
+func schemaFor(t reflect.Type) map[string]interface{} {
+	t = indirect(t)
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	// interface{} and anything else: accept any JSON value
+	return map[string]interface{}{}
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// structSchema builds an object schema from a struct's fields and tags
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Tag.Get("json") == "" && indirect(field.Type).Kind() == reflect.Struct {
+			embedded := structSchema(indirect(field.Type))
+			for name, prop := range embedded["properties"].(map[string]interface{}) {
+				properties[name] = prop
+			}
+			if req, ok := embedded["required"].([]string); ok {
+				required = append(required, req...)
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := schemaFor(field.Type)
+		if desc := field.Tag.Get("desc"); desc != "" {
+			prop["description"] = desc
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			prop["enum"] = strings.Split(enum, ",")
+		}
+		if n, err := strconv.Atoi(field.Tag.Get("minlen")); err == nil {
+			prop["minLength"] = n
+		}
+		if n, err := strconv.Atoi(field.Tag.Get("maxlen")); err == nil {
+			prop["maxLength"] = n
+		}
+		properties[name] = prop
+
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
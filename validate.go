@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"unicode/utf8"
+)
+
+/* ------------------------------------------------------------------------
+   TOOL ARGUMENT VALIDATION
+   ------------------------------------------------------------------------ */
+
+// validateArgs checks the model's arguments against a tool's parameters
+// schema and returns every problem found (nil if the arguments are fine)
+func validateArgs(schema map[string]interface{}, args map[string]interface{}) []string {
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	var problems []string
+	validateValue("arguments", schema, args, &problems)
+	return problems
+}
+
+// argumentError is the structured error sent back to the model when its
+// arguments don't match the schema, so it can fix them and try again
+func argumentError(tool string, problems []string) string {
+	b, _ := json.Marshal(map[string]interface{}{
+		"error":    fmt.Sprintf("invalid arguments for tool '%s'", tool),
+		"problems": problems,
+		"hint":     "Fix the arguments listed above and call the tool again.",
+	})
+	return string(b)
+}
+
+func validateValue(path string, schema map[string]interface{}, v interface{}, problems *[]string) {
+	typ, _ := schema["type"].(string)
+	if typ != "" && !hasJSONType(v, typ) {
+		*problems = append(*problems, fmt.Sprintf("%s: expected %s, got %s", path, typ, jsonTypeOf(v)))
+		return
+	}
+
+	if enum := schemaStrings(schema["enum"]); len(enum) > 0 {
+		s, _ := v.(string)
+		if !containsString(enum, s) {
+			*problems = append(*problems, fmt.Sprintf("%s: must be one of %v, got %v", path, enum, v))
+		}
+	}
+
+	switch val := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(val)
+		if minLen, ok := schemaInt(schema["minLength"]); ok && n < minLen {
+			*problems = append(*problems, fmt.Sprintf("%s: must be at least %d characters", path, minLen))
+		}
+		if maxLen, ok := schemaInt(schema["maxLength"]); ok && n > maxLen {
+			*problems = append(*problems, fmt.Sprintf("%s: must be at most %d characters", path, maxLen))
+		}
+
+	case map[string]interface{}:
+		for _, name := range schemaStrings(schema["required"]) {
+			if val[name] == nil {
+				*problems = append(*problems, fmt.Sprintf("%s.%s: required field is missing", path, name))
+			}
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		for name, propSchema := range props {
+			fieldValue, present := val[name]
+			ps, ok := propSchema.(map[string]interface{})
+			if !present || fieldValue == nil || !ok {
+				continue
+			}
+			validateValue(path+"."+name, ps, fieldValue, problems)
+		}
+
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range val {
+				validateValue(fmt.Sprintf("%s[%d]", path, i), items, item, problems)
+			}
+		}
+	}
+}
+
+// hasJSONType reports whether a decoded JSON value matches a schema type
+func hasJSONType(v interface{}, typ string) bool {
+	switch typ {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		switch v.(type) {
+		case float64, json.Number:
+			return true
+		}
+		return false
+	case "integer":
+		switch n := v.(type) {
+		case float64:
+			return n == math.Trunc(n)
+		case json.Number:
+			r, ok := new(big.Rat).SetString(n.String())
+			return ok && r.IsInt()
+		}
+		return false
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	}
+	return true
+}
+
+// jsonTypeOf names the JSON type of a decoded value for error messages
+func jsonTypeOf(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64, json.Number:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// schemaStrings reads a string list from a schema, whether it was built in Go
+// ([]string) or decoded from JSON ([]interface{})
+func schemaStrings(v interface{}) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []interface{}:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// schemaInt reads an integer keyword like minLength from a schema
+func schemaInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case float64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
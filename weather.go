@@ -0,0 +1,391 @@
+//go:build !bedrock
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+/* ------------------------------------------------------------------------
+   WEATHER LOOKUP (via a WeatherProvider, Open-Meteo by default)
+   ------------------------------------------------------------------------ */
+
+// Limits Open-Meteo puts on forecasts, and how many hourly rows we show
+const (
+	maxForecastDays = 16
+	maxHourlyRows   = 72
+)
+
+// weatherUnits are a unit system's name, for WeatherRequest, and the labels
+// to print
+type weatherUnits struct {
+	system                            string
+	tempLabel, windLabel, precipLabel string
+}
+
+var unitSystems = map[string]weatherUnits{
+	"imperial": {"imperial", "°F", "mph", "in"},
+	"metric":   {"metric", "°C", "km/h", "mm"},
+}
+
+// unitsFor looks up a unit system, imperial if name is empty
+func unitsFor(name string) (weatherUnits, error) {
+	if name == "" {
+		name = "imperial"
+	}
+	units, ok := unitSystems[name]
+	if !ok {
+		return weatherUnits{}, fmt.Errorf("unknown units '%s', use metric or imperial", name)
+	}
+	return units, nil
+}
+
+// WeatherProvider is a weather backend. OpenMeteo is the default, and
+// NewFixtureProvider makes one that works offline; another service only has
+// to fill in these types.
+type WeatherProvider interface {
+	// Forecast returns current conditions plus a daily forecast, or an
+	// hourly one if req.Hourly is set
+	Forecast(req WeatherRequest) (*WeatherData, error)
+	// History returns observed daily weather between req.StartDate and req.EndDate
+	History(req WeatherRequest) (*WeatherData, error)
+	// AirQuality returns current and hourly air quality; req.Units is unused
+	AirQuality(req WeatherRequest) (*AirQualityData, error)
+}
+
+// WeatherRequest says where and for which days to get weather. Values come
+// back in the requested unit system.
+type WeatherRequest struct {
+	Latitude, Longitude float64
+	Timezone            string // IANA zone the dates and times are in; empty for the place's own
+	Units               string // "metric" or "imperial"
+	Days                int    // days from today, when StartDate is empty
+	StartDate, EndDate  string // YYYY-MM-DD
+	Hourly              bool
+}
+
+// WeatherData holds weather as parallel series: Daily.Time[i] is the date the
+// other daily values at index i belong to, and likewise for Hourly. A nil
+// entry, or a series shorter than Time, is a value the provider doesn't have.
+type WeatherData struct {
+	Timezone string // the zone Time values are in
+	Current  *CurrentWeather
+	Daily    DailyWeather
+	Hourly   HourlyWeather
+}
+
+type CurrentWeather struct {
+	Time          string // local time, e.g. 2025-06-01T13:00
+	WeatherCode   *int   // WMO weather interpretation code
+	Temperature   float64
+	WindSpeed     float64
+	WindDirection float64 // degrees the wind comes from
+}
+
+type DailyWeather struct {
+	Time                        []string // YYYY-MM-DD
+	WeatherCode                 []*int
+	TemperatureMax              []*float64
+	TemperatureMin              []*float64
+	TemperatureMean             []*float64
+	PrecipitationSum            []*float64
+	PrecipitationProbabilityMax []*float64 // percent
+	UVIndexMax                  []*float64
+	WindSpeedMax                []*float64
+}
+
+type HourlyWeather struct {
+	Time                     []string // local time, e.g. 2025-06-01T13:00
+	WeatherCode              []*int
+	Temperature              []*float64
+	PrecipitationProbability []*float64 // percent
+	WindSpeed                []*float64
+}
+
+// AirQualityData is the US AQI and pollutant levels, in µg/m³
+type AirQualityData struct {
+	Timezone string
+	Current  *AirQualityReading
+	Hourly   HourlyAirQuality
+}
+
+type AirQualityReading struct {
+	Time  string
+	USAQI *float64
+	PM2_5 *float64
+}
+
+type HourlyAirQuality struct {
+	Time  []string
+	USAQI []*float64
+	PM2_5 []*float64
+	PM10  []*float64
+	Ozone []*float64
+}
+
+// WeatherTools are the weather and place tools, over one weather provider
+// and one geocoder
+type WeatherTools struct {
+	provider WeatherProvider
+	geocoder Geocoder
+}
+
+func NewWeatherTools(provider WeatherProvider, geocoder Geocoder) *WeatherTools {
+	return &WeatherTools{provider: provider, geocoder: geocoder}
+}
+
+func (w *WeatherTools) register(r *Registry) {
+	RegisterTyped(r, "geocode", "Finds places matching a name, ranked best first with country, region, population and coordinates, "+
+		"or names the place at a latitude/longitude. Use it when a place name is ambiguous, e.g. Springfield or Paris.",
+		func(args geocodeArgs) (string, error) {
+			return geocodePlaces(w.geocoder, args)
+		})
+
+	RegisterTyped(r, "get_weather", "Returns current conditions and a daily or hourly weather forecast (7 days by default) for the specified location.",
+		w.getWeatherForecast)
+
+	RegisterTyped(r, "get_weather_history", "Summarizes the observed weather for a location between two past dates: hottest, coldest and average "+
+		"temperatures, total precipitation and strongest wind, plus each day for short ranges.",
+		w.getWeatherHistory)
+
+	RegisterTyped(r, "get_air_quality", "Returns the current US air quality index (AQI) for a location and, per day, the worst AQI with its "+
+		"category and average PM2.5/PM10 levels.",
+		w.getAirQuality)
+}
+
+func (w *WeatherTools) getWeatherForecast(args weatherArgs) (string, error) {
+	units, err := unitsFor(args.Units)
+	if err != nil {
+		return "", err
+	}
+	if (args.StartDate == "") != (args.EndDate == "") {
+		return "", fmt.Errorf("give both start_date and end_date, or neither")
+	}
+	if args.StartDate != "" && args.ForecastDays != 0 {
+		return "", fmt.Errorf("use either forecast_days or start_date/end_date, not both")
+	}
+	if args.StartDate != "" {
+		from, to, err := parseDateRange(args.StartDate, args.EndDate)
+		if err != nil {
+			return "", err
+		}
+		if n := int(to.Sub(from).Hours()/24) + 1; n > maxForecastDays {
+			return "", fmt.Errorf("the range is %d days, ask for at most %d at a time", n, maxForecastDays)
+		}
+		// today in UTC can be yesterday where the place is, so allow a day more
+		horizon := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, maxForecastDays)
+		if to.After(horizon) {
+			return "", fmt.Errorf("end_date %s is past the forecast horizon, the forecast only covers the next %d days",
+				args.EndDate, maxForecastDays)
+		}
+	}
+	days := args.ForecastDays
+	switch {
+	case days < 0 || days > maxForecastDays:
+		return "", fmt.Errorf("forecast_days must be between 1 and %d", maxForecastDays)
+	case days == 0 && args.Hourly:
+		days = 2 // today and tomorrow is what hourly questions are usually about
+	case days == 0:
+		days = 7
+	}
+
+	// 1) find the place
+	location, lat, lon, tz, err := w.resolvePlace(args.placeArgs)
+	if err != nil {
+		return "", err
+	}
+
+	// 2) fetch the forecast
+	req := WeatherRequest{
+		Latitude:  lat,
+		Longitude: lon,
+		Timezone:  tz,
+		Units:     units.system,
+		Hourly:    args.Hourly,
+		StartDate: args.StartDate,
+		EndDate:   args.EndDate,
+	}
+	if args.StartDate == "" {
+		req.Days = days
+	}
+	data, err := w.provider.Forecast(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching forecast: %v", err)
+	}
+	tz = data.Timezone // the zone the provider picked if tz was empty
+
+	// 3) format a short text
+	result := ""
+	if cw := data.Current; cw != nil {
+		result += fmt.Sprintf("Current conditions for %s at %s: %s, %.1f%s, wind %.1f %s from the %s\n\n",
+			location, cw.Time, describeWeather([]*int{cw.WeatherCode}, 0), cw.Temperature, units.tempLabel,
+			cw.WindSpeed, units.windLabel, compassPoint(cw.WindDirection))
+	}
+
+	period := fmt.Sprintf("%d-day", days)
+	if args.StartDate != "" {
+		period = fmt.Sprintf("%s to %s", args.StartDate, args.EndDate)
+	}
+	if args.Hourly {
+		return result + formatHourly(data, units, fmt.Sprintf("Hourly forecast for %s, %s (timezone: %s):\n\n", location, period, tz)), nil
+	}
+
+	if len(data.Daily.Time) == 0 {
+		return result + fmt.Sprintf("No daily forecast found for %s", location), nil
+	}
+	result += fmt.Sprintf("Daily forecast for %s, %s (timezone: %s):\n\n", location, period, tz)
+	for i, day := range data.Daily.Time {
+		desc := describeWeather(data.Daily.WeatherCode, i)
+		maxT := formatReading(data.Daily.TemperatureMax, i, "%.1f"+units.tempLabel)
+		minT := formatReading(data.Daily.TemperatureMin, i, "%.1f"+units.tempLabel)
+		result += fmt.Sprintf("%s: %s, %s / %s, chance of precipitation %s, UV index %s, max wind %s\n",
+			day, desc, maxT, minT,
+			formatReading(data.Daily.PrecipitationProbabilityMax, i, "%.0f%%"),
+			formatReading(data.Daily.UVIndexMax, i, "%.1f"),
+			formatReading(data.Daily.WindSpeedMax, i, "%.1f "+units.windLabel))
+	}
+	return result, nil
+}
+
+// resolvePlace turns a place_id, coordinates or a location name into a label
+// for the output, coordinates and a time zone (empty for coordinates, so the
+// provider picks it)
+func (w *WeatherTools) resolvePlace(args placeArgs) (string, float64, float64, string, error) {
+	given := 0
+	for _, set := range []bool{args.Location != "", args.PlaceID != 0, args.Latitude != nil || args.Longitude != nil} {
+		if set {
+			given++
+		}
+	}
+	if given != 1 {
+		return "", 0, 0, "", fmt.Errorf("give exactly one of location, place_id, or latitude and longitude")
+	}
+
+	switch {
+	case args.PlaceID != 0:
+		place, err := w.geocoder.PlaceByID(args.PlaceID)
+		if err != nil {
+			return "", 0, 0, "", err
+		}
+		return place.Label(), place.Latitude, place.Longitude, place.Timezone, nil
+
+	case args.Latitude != nil || args.Longitude != nil:
+		if args.Latitude == nil || args.Longitude == nil {
+			return "", 0, 0, "", fmt.Errorf("give both latitude and longitude")
+		}
+		lat, lon := *args.Latitude, *args.Longitude
+		if err := checkCoordinates(lat, lon); err != nil {
+			return "", 0, 0, "", err
+		}
+		return fmt.Sprintf("%.4f, %.4f", lat, lon), lat, lon, "", nil
+	}
+
+	places, err := w.geocoder.SearchPlaces(args.Location, 1, "")
+	if err != nil {
+		return "", 0, 0, "", fmt.Errorf("geocoding location '%s': %v", args.Location, err)
+	}
+	if len(places) == 0 {
+		return "", 0, 0, "", fmt.Errorf("geocoding location '%s': no results", args.Location)
+	}
+	return places[0].Label(), places[0].Latitude, places[0].Longitude, places[0].Timezone, nil
+}
+
+// formatHourly lists the hourly values, up to maxHourlyRows of them
+func formatHourly(data *WeatherData, units weatherUnits, title string) string {
+	hourly := data.Hourly
+	if len(hourly.Time) == 0 {
+		return "No hourly forecast found"
+	}
+	result := title
+	for i, hour := range hourly.Time {
+		if i == maxHourlyRows {
+			result += fmt.Sprintf("(%d more hours not shown; ask for a shorter start_date/end_date range to see them)\n",
+				len(hourly.Time)-maxHourlyRows)
+			break
+		}
+		result += fmt.Sprintf("%s: %s, %s, chance of precipitation %s, wind %s\n",
+			strings.Replace(hour, "T", " ", 1), describeWeather(hourly.WeatherCode, i),
+			formatReading(hourly.Temperature, i, "%.1f"+units.tempLabel),
+			formatReading(hourly.PrecipitationProbability, i, "%.0f%%"),
+			formatReading(hourly.WindSpeed, i, "%.1f "+units.windLabel))
+	}
+	return result
+}
+
+// describeWeather names the i'th weather code; like formatReading, it says
+// n/a for a null or missing one rather than reading it as 0, clear sky
+func describeWeather(codes []*int, i int) string {
+	if i >= len(codes) || codes[i] == nil {
+		return "n/a"
+	}
+	if desc, ok := wmoWeatherCodes[*codes[i]]; ok {
+		return desc
+	}
+	return fmt.Sprintf("unknown (code %d)", *codes[i])
+}
+
+// formatReading formats values[i], or "n/a" if the provider had no value
+func formatReading(values []*float64, i int, format string) string {
+	if i >= len(values) || values[i] == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf(format, *values[i])
+}
+
+// compassPoint turns a wind direction in degrees into e.g. "NW"
+func compassPoint(degrees float64) string {
+	points := []string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+	i := int(math.Mod(degrees+22.5+360, 360) / 45)
+	return points[i%8]
+}
+
+var wmoWeatherCodes = map[int]string{
+	0:  "Clear sky",
+	1:  "Mainly clear",
+	2:  "Partly cloudy",
+	3:  "Overcast",
+	45: "Fog",
+	48: "Depositing rime fog",
+	51: "Light drizzle",
+	53: "Moderate drizzle",
+	55: "Dense drizzle",
+	56: "Light freezing drizzle",
+	57: "Dense freezing drizzle",
+	61: "Slight rain",
+	63: "Moderate rain",
+	65: "Heavy rain",
+	66: "Light freezing rain",
+	67: "Heavy freezing rain",
+	71: "Slight snowfall",
+	73: "Moderate snowfall",
+	75: "Heavy snowfall",
+	80: "Slight rain showers",
+	81: "Moderate rain showers",
+	82: "Violent rain showers",
+	85: "Slight snow showers",
+	86: "Heavy snow showers",
+	95: "Thunderstorm",
+	96: "Thunderstorm with hail",
+	99: "Severe thunderstorm with hail",
+}
+
+// placeArgs are the ways a weather tool can be told where: a name, a
+// geocode candidate or coordinates
+type placeArgs struct {
+	Location  string   `json:"location,omitempty" desc:"City or place; if it could be several places, use geocode and pass place_id instead" minlen:"1"`
+	PlaceID   int64    `json:"place_id,omitempty" desc:"id of a candidate returned by the geocode tool"`
+	Latitude  *float64 `json:"latitude,omitempty" desc:"Latitude in degrees, with longitude, instead of a location"`
+	Longitude *float64 `json:"longitude,omitempty" desc:"Longitude in degrees"`
+}
+
+type weatherArgs struct {
+	placeArgs
+	Hourly       bool   `json:"hourly,omitempty" desc:"Give hour-by-hour values instead of one line per day"`
+	StartDate    string `json:"start_date,omitempty" desc:"First day to forecast, YYYY-MM-DD; needs end_date"`
+	EndDate      string `json:"end_date,omitempty" desc:"Last day to forecast, YYYY-MM-DD, at most 16 days from today"`
+	ForecastDays int    `json:"forecast_days,omitempty" desc:"Number of days from today, 1-16 (default 7, or 2 when hourly)"`
+	Units        string `json:"units,omitempty" desc:"Unit system (default imperial: °F, mph)" enum:"metric,imperial"`
+}
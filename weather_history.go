@@ -0,0 +1,174 @@
+//go:build !bedrock
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+/* ------------------------------------------------------------------------
+   HISTORICAL WEATHER
+   ------------------------------------------------------------------------ */
+
+// maxHistoryDays caps the range of one historical lookup, and
+// maxHistoryDailyRows is the longest range that also lists every day
+const (
+	maxHistoryDays      = 366
+	maxHistoryDailyRows = 14
+)
+
+type weatherHistoryArgs struct {
+	placeArgs
+	StartDate string `json:"start_date" desc:"First day, YYYY-MM-DD (data goes back to 1940)"`
+	EndDate   string `json:"end_date" desc:"Last day, YYYY-MM-DD; the archive lags about 5 days behind today"`
+	Units     string `json:"units,omitempty" desc:"Unit system (default imperial: °F, mph, inches)" enum:"metric,imperial"`
+}
+
+// getWeatherHistory summarizes the observed weather between two dates:
+// temperature extremes and mean, precipitation and wind, plus one line per
+// day for short ranges
+func (w *WeatherTools) getWeatherHistory(args weatherHistoryArgs) (string, error) {
+	units, err := unitsFor(args.Units)
+	if err != nil {
+		return "", err
+	}
+	from, to, err := parseDateRange(args.StartDate, args.EndDate)
+	if err != nil {
+		return "", err
+	}
+	days := int(to.Sub(from).Hours()/24) + 1
+	if days > maxHistoryDays {
+		return "", fmt.Errorf("the range is %d days, ask for at most %d at a time", days, maxHistoryDays)
+	}
+
+	location, lat, lon, tz, err := w.resolvePlace(args.placeArgs)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := w.provider.History(WeatherRequest{
+		Latitude:  lat,
+		Longitude: lon,
+		Timezone:  tz,
+		Units:     units.system,
+		StartDate: args.StartDate,
+		EndDate:   args.EndDate,
+	})
+	if err != nil {
+		return "", fmt.Errorf("fetching weather history: %v", err)
+	}
+	daily := data.Daily
+	high := summarize(daily.TemperatureMax)
+	if high.count == 0 {
+		return "", fmt.Errorf("the archive has no data for %s to %s yet, it lags about 5 days behind today",
+			args.StartDate, args.EndDate)
+	}
+	low := summarize(daily.TemperatureMin)
+	mean := summarize(daily.TemperatureMean)
+	precip := summarize(daily.PrecipitationSum)
+	wind := summarize(daily.WindSpeedMax)
+
+	t, wl, p := units.tempLabel, units.windLabel, units.precipLabel
+	result := fmt.Sprintf("Weather history for %s, %s to %s (%d days with data):\n", location, args.StartDate, args.EndDate, high.count)
+	result += fmt.Sprintf("Hottest: %.1f%s on %s\n", high.max, t, dayAt(daily.Time, high.maxAt))
+	if low.count > 0 {
+		result += fmt.Sprintf("Coldest: %.1f%s on %s\n", low.min, t, dayAt(daily.Time, low.minAt))
+	}
+	result += fmt.Sprintf("Average daily high %s, low %s, mean %s\n",
+		high.meanText("%.1f"+t), low.meanText("%.1f"+t), mean.meanText("%.1f"+t))
+	if precip.count > 0 {
+		result += fmt.Sprintf("Precipitation: %.2f %s in total, %d days with precipitation, wettest %s with %.2f %s\n",
+			precip.sum, p, precip.nonZero, dayAt(daily.Time, precip.maxAt), precip.max, p)
+	}
+	if wind.count > 0 {
+		result += fmt.Sprintf("Strongest wind: %.1f %s on %s\n", wind.max, wl, dayAt(daily.Time, wind.maxAt))
+	}
+
+	if len(daily.Time) <= maxHistoryDailyRows {
+		result += "\n"
+		for i, day := range daily.Time {
+			result += fmt.Sprintf("%s: high %s, low %s, precipitation %s, max wind %s\n", day,
+				formatReading(daily.TemperatureMax, i, "%.1f"+t),
+				formatReading(daily.TemperatureMin, i, "%.1f"+t),
+				formatReading(daily.PrecipitationSum, i, "%.2f "+p),
+				formatReading(daily.WindSpeedMax, i, "%.1f "+wl))
+		}
+	}
+	return result, nil
+}
+
+// parseDateRange checks a required YYYY-MM-DD start and end date
+func parseDateRange(start, end string) (time.Time, time.Time, error) {
+	from, err := time.Parse("2006-01-02", start)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("start_date '%s' is not a date, use YYYY-MM-DD", start)
+	}
+	to, err := time.Parse("2006-01-02", end)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("end_date '%s' is not a date, use YYYY-MM-DD", end)
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end_date %s is before start_date %s", end, start)
+	}
+	return from, to, nil
+}
+
+// seriesStats summarizes a series that may have gaps
+type seriesStats struct {
+	min, max, sum float64
+	minAt, maxAt  int // indexes of the extremes
+	count         int // values present
+	nonZero       int // values above zero
+}
+
+func (s seriesStats) mean() float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	return s.sum / float64(s.count)
+}
+
+// meanText, maxText and minText format a statistic, or give "n/a" like
+// formatReading when the series had no values, rather than NaN or ±Inf
+func (s seriesStats) meanText(format string) string { return s.text(format, s.mean()) }
+func (s seriesStats) maxText(format string) string  { return s.text(format, s.max) }
+func (s seriesStats) minText(format string) string  { return s.text(format, s.min) }
+
+func (s seriesStats) text(format string, value float64) string {
+	if s.count == 0 {
+		return "n/a"
+	}
+	return fmt.Sprintf(format, value)
+}
+
+// dayAt is times[i], or "n/a" if the provider sent fewer times than values
+func dayAt(times []string, i int) string {
+	if i >= len(times) {
+		return "n/a"
+	}
+	return times[i]
+}
+
+// summarize skips the nulls providers send for missing values
+func summarize(values []*float64) seriesStats {
+	s := seriesStats{min: math.Inf(1), max: math.Inf(-1)}
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		s.count++
+		s.sum += *v
+		if *v > 0 {
+			s.nonZero++
+		}
+		if *v < s.min {
+			s.min, s.minAt = *v, i
+		}
+		if *v > s.max {
+			s.max, s.maxAt = *v, i
+		}
+	}
+	return s
+}
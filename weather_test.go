@@ -0,0 +1,201 @@
+//go:build !bedrock
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWeatherToolsWithFixtures runs the weather tools end to end against the
+// saved Open-Meteo and Nominatim responses in testdata/weather
+func TestWeatherToolsWithFixtures(t *testing.T) {
+	backend := NewFixtureProvider("testdata/weather")
+	registry := newToolRegistry(backend, backend)
+
+	tests := []struct {
+		tool string
+		args string
+		want []string
+	}{
+		{"geocode", `{"query": "Springfield"}`,
+			[]string{`"label": "Springfield, Illinois, United States"`, `"label": "Springfield, Missouri, United States"`, `"rank": 2`}},
+		{"geocode", `{"latitude": 39.8, "longitude": -89.64}`,
+			[]string{`"city": "Springfield"`, `"country_code": "US"`}},
+		{"get_weather", `{"location": "Springfield", "forecast_days": 3}`,
+			[]string{
+				"Current conditions for Springfield, Illinois, United States",
+				"2025-06-01: Partly cloudy, 81.2°F / 62.1°F, chance of precipitation 10%, UV index 7.5, max wind 12.4 mph",
+				"2025-06-02: Slight rain, 75.0°F / n/a",
+				"2025-06-03: n/a, 72.3°F / 58.8°F", // a null weather code
+			}},
+		{"get_weather", `{"place_id": 4409896, "hourly": true}`,
+			[]string{"Hourly forecast for Springfield, Missouri, United States", "2025-06-01 14:00: n/a, 79.1°F"}},
+		{"get_weather_history", `{"location": "Springfield", "start_date": "2024-07-01", "end_date": "2024-07-03"}`,
+			[]string{"Hottest: 91.2°F on 2024-07-02", "Coldest: 65.2°F on 2024-07-03", "0.47 in in total, 2 days with precipitation"}},
+		{"get_air_quality", `{"location": "Springfield", "forecast_days": 2}`,
+			[]string{"Now (2025-06-01T13:00): AQI 42, Good", "2025-06-01: worst AQI 57 (Moderate)", "2025-06-02: worst AQI 112 (Unhealthy for sensitive groups)"}},
+	}
+
+	for _, tt := range tests {
+		// arguments arrive as decoded JSON, so numbers are float64
+		var args map[string]interface{}
+		if err := json.Unmarshal([]byte(tt.args), &args); err != nil {
+			t.Fatalf("%s: bad test arguments: %v", tt.tool, err)
+		}
+		result, failed := registry.Call(tt.tool, args)
+		if failed {
+			t.Errorf("%s(%s) failed: %s", tt.tool, tt.args, result)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result, want) {
+				t.Errorf("%s(%s) = %q, want it to contain %q", tt.tool, tt.args, result, want)
+			}
+		}
+	}
+}
+
+func TestWeatherToolsMissingFixture(t *testing.T) {
+	backend := NewFixtureProvider("testdata/weather")
+	registry := newToolRegistry(backend, backend)
+
+	result, failed := registry.Call("get_weather", map[string]interface{}{"location": "Nowhere"})
+	if !failed || !strings.Contains(result, "search_nowhere.json") {
+		t.Errorf("get_weather for an unknown place = %q, %v; want a failed call naming the fixture it looked for", result, failed)
+	}
+}
+
+func TestWeatherForecastDates(t *testing.T) {
+	registry := newToolRegistry(&stubWeather{}, NewFixtureProvider("testdata/weather"))
+	today := time.Now().UTC()
+
+	tests := []struct {
+		start, end string
+		wantErr    string
+	}{
+		{"2025-06-01", "2025-06-0x", "not a date"},
+		{"2025-06-03", "2025-06-01", "before start_date"},
+		{"2025-06-01", "2025-06-30", "at most 16"},
+		{today.AddDate(0, 0, 20).Format("2006-01-02"), today.AddDate(0, 0, 22).Format("2006-01-02"), "forecast horizon"},
+		{today.Format("2006-01-02"), today.AddDate(0, 0, 3).Format("2006-01-02"), ""},
+	}
+	for _, tt := range tests {
+		args := map[string]interface{}{"latitude": 48.85, "longitude": 2.35, "start_date": tt.start, "end_date": tt.end}
+		result, failed := registry.Call("get_weather", args)
+		if tt.wantErr == "" {
+			if failed {
+				t.Errorf("get_weather from %s to %s failed: %s", tt.start, tt.end, result)
+			}
+			continue
+		}
+		if !failed || !strings.Contains(result, tt.wantErr) {
+			t.Errorf("get_weather from %s to %s = %q, %v; want an error containing %q", tt.start, tt.end, result, failed, tt.wantErr)
+		}
+	}
+}
+
+// stubWeather is a WeatherProvider that isn't Open-Meteo
+type stubWeather struct{ last WeatherRequest }
+
+func (s *stubWeather) Forecast(req WeatherRequest) (*WeatherData, error) {
+	s.last = req
+	high, low, code := 21.5, 12.0, 3
+	return &WeatherData{
+		Timezone: "Europe/Paris",
+		Daily: DailyWeather{
+			Time:           []string{"2025-06-01"},
+			WeatherCode:    []*int{&code},
+			TemperatureMax: []*float64{&high},
+			TemperatureMin: []*float64{&low},
+		},
+	}, nil
+}
+
+// History has daily highs only, as if the lows and means weren't processed yet
+func (s *stubWeather) History(req WeatherRequest) (*WeatherData, error) {
+	s.last = req
+	high := 25.0
+	return &WeatherData{
+		Daily: DailyWeather{
+			Time:           []string{"2024-07-01", "2024-07-02"},
+			TemperatureMax: []*float64{&high, nil},
+			TemperatureMin: []*float64{nil, nil},
+		},
+	}, nil
+}
+
+// AirQuality has the AQI but no pollutant series
+func (s *stubWeather) AirQuality(req WeatherRequest) (*AirQualityData, error) {
+	s.last = req
+	aqi := 40.0
+	return &AirQualityData{
+		Hourly: HourlyAirQuality{Time: []string{"2025-06-01T00:00"}, USAQI: []*float64{&aqi}},
+	}, nil
+}
+
+func TestWeatherToolsWithAnotherProvider(t *testing.T) {
+	weather := &stubWeather{}
+	registry := newToolRegistry(weather, NewFixtureProvider("testdata/weather"))
+
+	result, failed := registry.Call("get_weather", map[string]interface{}{"latitude": 48.85, "longitude": 2.35, "units": "metric"})
+	if failed || !strings.Contains(result, "2025-06-01: Overcast, 21.5°C / 12.0°C") || !strings.Contains(result, "timezone: Europe/Paris") {
+		t.Errorf("get_weather with a stub provider = %q, %v", result, failed)
+	}
+	want := WeatherRequest{Latitude: 48.85, Longitude: 2.35, Units: "metric", Days: 7}
+	if weather.last != want {
+		t.Errorf("the provider got %+v, want %+v", weather.last, want)
+	}
+}
+
+func TestWeatherToolsMissingSeries(t *testing.T) {
+	registry := newToolRegistry(&stubWeather{}, NewFixtureProvider("testdata/weather"))
+
+	tests := []struct {
+		tool string
+		args map[string]interface{}
+		want []string
+	}{
+		{"get_weather_history", map[string]interface{}{"latitude": 48.85, "longitude": 2.35, "start_date": "2024-07-01", "end_date": "2024-07-02"},
+			[]string{"Hottest: 25.0°F on 2024-07-01", "Average daily high 25.0°F, low n/a, mean n/a"}},
+		{"get_air_quality", map[string]interface{}{"latitude": 48.85, "longitude": 2.35},
+			[]string{"average PM2.5 n/a, PM10 n/a; peak ozone n/a"}},
+	}
+	for _, tt := range tests {
+		result, failed := registry.Call(tt.tool, tt.args)
+		if failed {
+			t.Errorf("%s failed: %s", tt.tool, result)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(result, want) {
+				t.Errorf("%s = %q, want it to contain %q", tt.tool, result, want)
+			}
+		}
+		for _, bad := range []string{"NaN", "Inf", "Coldest"} {
+			if strings.Contains(result, bad) {
+				t.Errorf("%s = %q, which has %q", tt.tool, result, bad)
+			}
+		}
+	}
+}
+
+// emptyGeocoder finds nothing, and doesn't say so with an error
+type emptyGeocoder struct{ Geocoder }
+
+func (emptyGeocoder) SearchPlaces(name string, count int, countryCode string) ([]GeoPlace, error) {
+	return nil, nil
+}
+
+func TestGeocoderWithNoResults(t *testing.T) {
+	registry := newToolRegistry(&stubWeather{}, emptyGeocoder{NewFixtureProvider("testdata/weather")})
+
+	for _, tool := range []string{"get_weather", "get_time"} {
+		result, failed := registry.Call(tool, map[string]interface{}{"location": "Nowhere"})
+		if !failed || !strings.Contains(result, "no results") && !strings.Contains(result, "no geocoding results") {
+			t.Errorf("%s for a place the geocoder can't find = %q, %v; want a failed call saying so", tool, result, failed)
+		}
+	}
+}